@@ -0,0 +1,308 @@
+// Package backup snapshots MongoDB databases to compressed local archives
+// and restores them.
+//
+// Every snapshot is a directory <dir>/<database>/<id> holding one gzipped
+// file of extended JSON documents per collection, one document per line,
+// and a manifest.json with the number of documents and a SHA-256 checksum
+// of every file.
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	manifestFile = "manifest.json"
+	idFormat     = "20060102T150405.000000000Z"
+	batchSize    = 1000
+)
+
+// Manifest describes a snapshot.
+type Manifest struct {
+	ID          string           `json:"id"`
+	Database    string           `json:"database"`
+	CreatedAt   time.Time        `json:"created_at"`
+	Collections []CollectionFile `json:"collections"`
+}
+
+// CollectionFile describes the archive of a single collection.
+type CollectionFile struct {
+	Name      string `json:"name"`
+	File      string `json:"file"`
+	Documents int64  `json:"documents"`
+	SHA256    string `json:"sha256"`
+}
+
+// Snapshot writes all collections of db to a new snapshot in dir.
+// The snapshot is written to a temporary directory that is renamed when
+// complete, so a failed snapshot never shows up as a valid one.
+func Snapshot(ctx context.Context, db *mongo.Database, dir string) (*Manifest, error) {
+	now := time.Now().UTC()
+	manifest := &Manifest{
+		ID:        now.Format(idFormat),
+		Database:  db.Name(),
+		CreatedAt: now,
+	}
+
+	// Concurrent snapshots of the same database get their own temporary
+	// directories, and never replace each other
+	parent := filepath.Join(dir, db.Name())
+	final := filepath.Join(parent, manifest.ID)
+	if err := os.MkdirAll(parent, 0o755); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp(parent, manifest.ID+"-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	names, err := db.ListCollectionNames(ctx, bson.M{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list collections: %v", err)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		file, err := dumpCollection(ctx, db.Collection(name), tmp)
+		if err != nil {
+			return nil, fmt.Errorf("cannot back up collection %s: %v", name, err)
+		}
+		manifest.Collections = append(manifest.Collections, *file)
+	}
+
+	if err := writeManifest(tmp, manifest); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(final); err == nil {
+		return nil, fmt.Errorf("snapshot %s already exists", final)
+	}
+	if err := os.Rename(tmp, final); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func dumpCollection(ctx context.Context, coll *mongo.Collection, dir string) (*CollectionFile, error) {
+	file := &CollectionFile{Name: coll.Name(), File: coll.Name() + ".jsonl.gz"}
+
+	f, err := os.Create(filepath.Join(dir, file.File))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// The checksum is computed over the compressed bytes, as written to disk
+	hash := sha256.New()
+	zw := gzip.NewWriter(io.MultiWriter(f, hash))
+
+	cur, err := coll.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		line, err := bson.MarshalExtJSON(cur.Current, true, false)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := zw.Write(append(line, '\n')); err != nil {
+			return nil, err
+		}
+		file.Documents++
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil
+}
+
+// Restore loads the snapshot with the given id of database into db.
+// All checksums are verified before anything is written, and the target
+// collections must be empty, so a snapshot is only restored into a
+// fresh database.
+func Restore(ctx context.Context, db *mongo.Database, dir string, database string, id string) (*Manifest, error) {
+	snapshot := filepath.Join(dir, database, id)
+	manifest, err := readManifest(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range manifest.Collections {
+		if err := verify(snapshot, file); err != nil {
+			return nil, err
+		}
+		n, err := db.Collection(file.Name).EstimatedDocumentCount(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot count documents in %s: %v", file.Name, err)
+		}
+		if n > 0 {
+			return nil, fmt.Errorf("collection %s.%s is not empty", db.Name(), file.Name)
+		}
+	}
+
+	for _, file := range manifest.Collections {
+		if err := loadCollection(ctx, db.Collection(file.Name), snapshot, file); err != nil {
+			return nil, fmt.Errorf("cannot restore collection %s: %v", file.Name, err)
+		}
+	}
+	return manifest, nil
+}
+
+func verify(snapshot string, file CollectionFile) error {
+	f, err := os.Open(filepath.Join(snapshot, file.File))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != file.SHA256 {
+		return fmt.Errorf("checksum mismatch for %s: got %s, want %s", file.File, sum, file.SHA256)
+	}
+	return nil
+}
+
+func loadCollection(ctx context.Context, coll *mongo.Collection, snapshot string, file CollectionFile) error {
+	f, err := os.Open(filepath.Join(snapshot, file.File))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	var count int64
+	batch := make([]interface{}, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if _, err := coll.InsertMany(ctx, batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		doc := bson.D{}
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &doc); err != nil {
+			return err
+		}
+		batch = append(batch, doc)
+		count++
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	if count != file.Documents {
+		return fmt.Errorf("restored %d documents, manifest has %d", count, file.Documents)
+	}
+	return nil
+}
+
+// List returns the manifests of all snapshots of database, oldest first.
+func List(dir string, database string) ([]*Manifest, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, database))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := []*Manifest{}
+	for _, entry := range entries {
+		if !entry.IsDir() || filepath.Ext(entry.Name()) == ".tmp" {
+			continue
+		}
+		manifest, err := readManifest(filepath.Join(dir, database, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		manifests = append(manifests, manifest)
+	}
+	sort.Slice(manifests, func(i, j int) bool {
+		return manifests[i].CreatedAt.Before(manifests[j].CreatedAt)
+	})
+	return manifests, nil
+}
+
+// Prune removes all but the keep most recent snapshots of database. It
+// refuses to keep less than one, which would remove every snapshot.
+func Prune(dir string, database string, keep int) error {
+	if keep < 1 {
+		return fmt.Errorf("cannot keep %d snapshots, at least 1 must be kept", keep)
+	}
+	manifests, err := List(dir, database)
+	if err != nil {
+		return err
+	}
+	for len(manifests) > keep {
+		if err := os.RemoveAll(filepath.Join(dir, database, manifests[0].ID)); err != nil {
+			return err
+		}
+		manifests = manifests[1:]
+	}
+	return nil
+}
+
+func writeManifest(snapshot string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(snapshot, manifestFile), data, 0o644)
+}
+
+func readManifest(snapshot string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(snapshot, manifestFile))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest in %s: %v", snapshot, err)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,32 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPruneKeepsAtLeastOne(t *testing.T) {
+	dir := t.TempDir()
+	manifest := &Manifest{ID: "20240101T000000.000000000Z", Database: "blogDB", CreatedAt: time.Now()}
+	snapshot := filepath.Join(dir, manifest.Database, manifest.ID)
+	if err := os.MkdirAll(snapshot, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeManifest(snapshot, manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keep := range []int{0, -1} {
+		if err := Prune(dir, manifest.Database, keep); err == nil {
+			t.Errorf("Prune(keep=%d) = nil, want an error", keep)
+		}
+	}
+	if _, err := os.Stat(snapshot); err != nil {
+		t.Errorf("Prune removed the snapshot: %v", err)
+	}
+	if err := Prune(dir, manifest.Database, 1); err != nil {
+		t.Errorf("Prune(keep=1) = %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/backup"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const usage = `Usage: blogadmin <command> [flags]
+
+Commands:
+  backup   Snapshot a blog database
+  list     List the snapshots of a blog database
+  restore  Restore a snapshot into a fresh database
+
+Run blogadmin <command> -h for the flags of a command.
+`
+
+func main() {
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "backup":
+		backupCommand(os.Args[2:])
+	case "list":
+		listCommand(os.Args[2:])
+	case "restore":
+		restoreCommand(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func backupCommand(args []string) {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	uri := fs.String("mongo-uri", "mongodb://localhost:27017", "MongoDB connection string")
+	database := fs.String("db", "blogDB", "Database to back up")
+	dir := fs.String("dir", "backups", "Directory of the snapshots")
+	fs.Parse(args)
+
+	client := connect(*uri)
+	defer client.Disconnect(context.TODO())
+
+	manifest, err := backup.Snapshot(context.TODO(), client.Database(*database), *dir)
+	if err != nil {
+		log.Fatalf("Backup failed: %v\n", err)
+	}
+	fmt.Printf("Created snapshot %s of %s\n", manifest.ID, manifest.Database)
+	printManifest(manifest)
+}
+
+func listCommand(args []string) {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	database := fs.String("db", "blogDB", "Database of the snapshots")
+	dir := fs.String("dir", "backups", "Directory of the snapshots")
+	fs.Parse(args)
+
+	manifests, err := backup.List(*dir, *database)
+	if err != nil {
+		log.Fatalf("Cannot list snapshots: %v\n", err)
+	}
+	for _, manifest := range manifests {
+		printManifest(manifest)
+	}
+}
+
+func restoreCommand(args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	uri := fs.String("mongo-uri", "mongodb://localhost:27017", "MongoDB connection string")
+	database := fs.String("db", "blogDB", "Database of the snapshot")
+	dir := fs.String("dir", "backups", "Directory of the snapshots")
+	id := fs.String("snapshot", "", "ID of the snapshot to restore, defaults to the latest")
+	into := fs.String("into", "", "Fresh database to restore into (required)")
+	fs.Parse(args)
+
+	if *into == "" {
+		log.Fatalln("The -into flag is required")
+	}
+	if *id == "" {
+		manifests, err := backup.List(*dir, *database)
+		if err != nil {
+			log.Fatalf("Cannot list snapshots: %v\n", err)
+		}
+		if len(manifests) == 0 {
+			log.Fatalf("No snapshots of %s in %s\n", *database, *dir)
+		}
+		*id = manifests[len(manifests)-1].ID
+	}
+
+	client := connect(*uri)
+	defer client.Disconnect(context.TODO())
+
+	manifest, err := backup.Restore(context.TODO(), client.Database(*into), *dir, *database, *id)
+	if err != nil {
+		log.Fatalf("Restore failed: %v\n", err)
+	}
+	fmt.Printf("Restored snapshot %s of %s into %s\n", manifest.ID, manifest.Database, *into)
+}
+
+func connect(uri string) *mongo.Client {
+	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.Ping(context.TODO(), nil); err != nil {
+		log.Fatal(err)
+	}
+	return client
+}
+
+func printManifest(manifest *backup.Manifest) {
+	fmt.Printf("%s  %s\n", manifest.ID, manifest.CreatedAt.Format("2006-01-02 15:04:05"))
+	for _, file := range manifest.Collections {
+		fmt.Printf("  %-20s %8d documents  sha256:%s\n", file.Name, file.Documents, file.SHA256)
+	}
+}
@@ -0,0 +1,61 @@
+package blogservice
+
+import (
+	"context"
+	"crypto/subtle"
+	"flag"
+	"os"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var adminToken = flag.String("admin-token", "", "Bearer token of BlogAdminService calls, defaults to $BLOG_ADMIN_TOKEN, empty denies all of them")
+
+const adminMethodPrefix = "/blog.BlogAdminService/"
+
+// authorizeAdmin checks the bearer token of BlogAdminService calls, as
+// they may provision and drop the databases of any tenant. The calls of
+// other services pass.
+func authorizeAdmin(ctx context.Context, method string) error {
+	if !strings.HasPrefix(method, adminMethodPrefix) {
+		return nil
+	}
+	token := *adminToken
+	if token == "" {
+		token = os.Getenv("BLOG_ADMIN_TOKEN")
+	}
+	if token == "" {
+		return status.Error(codes.PermissionDenied, "BlogAdminService is disabled, the server has no admin token")
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		bearer, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(bearer), []byte(token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "Missing or invalid admin token")
+}
+
+// UnaryAdminAuthInterceptor requires the admin token on unary
+// BlogAdminService calls.
+func UnaryAdminAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := authorizeAdmin(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamAdminAuthInterceptor requires the admin token on streaming
+// BlogAdminService calls.
+func StreamAdminAuthInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := authorizeAdmin(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
@@ -0,0 +1,43 @@
+package blogservice
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuthorizeAdmin(t *testing.T) {
+	defer func(token string) { *adminToken = token }(*adminToken)
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		auth   []string
+		want   codes.Code
+	}{
+		{"blog call", "secret", "/blog.BlogService/ListBlog", nil, codes.OK},
+		{"admin call", "secret", "/blog.BlogAdminService/DeleteTenant", []string{"Bearer secret"}, codes.OK},
+		{"missing token", "secret", "/blog.BlogAdminService/DeleteTenant", nil, codes.Unauthenticated},
+		{"wrong token", "secret", "/blog.BlogAdminService/DeleteTenant", []string{"Bearer guess"}, codes.Unauthenticated},
+		{"not a bearer token", "secret", "/blog.BlogAdminService/DeleteTenant", []string{"secret"}, codes.Unauthenticated},
+		{"no server token", "", "/blog.BlogAdminService/DeleteTenant", []string{"Bearer "}, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BLOG_ADMIN_TOKEN", "")
+			*adminToken = tt.token
+			md := metadata.MD{}
+			for _, value := range tt.auth {
+				md.Append("authorization", value)
+			}
+			ctx := metadata.NewIncomingContext(context.Background(), md)
+			if got := status.Code(authorizeAdmin(ctx, tt.method)); got != tt.want {
+				t.Errorf("authorizeAdmin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package blogservice
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"time"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/backup"
+)
+
+var (
+	backupDir      = flag.String("backup-dir", "", "Directory of the scheduled backups, empty disables them")
+	backupInterval = flag.Duration("backup-interval", 24*time.Hour, "Time between scheduled backups")
+	backupKeep     = flag.Int("backup-keep", 7, "Number of backups kept of each database")
+)
+
+// RunBackups snapshots the databases of all tenants at once and then
+// every backup interval, until ctx is canceled. It returns at once if
+// backups are disabled.
+func (s *Service) RunBackups(ctx context.Context) {
+	if *backupDir == "" {
+		return
+	}
+	s.backupAll(ctx)
+	ticker := time.NewTicker(*backupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.backupAll(ctx)
+		}
+	}
+}
+
+func (s *Service) backupAll(ctx context.Context) {
+	for _, db := range s.tenants.databases() {
+		manifest, err := backup.Snapshot(ctx, db, *backupDir)
+		if err != nil {
+			slog.Error("Backup failed", "database", db.Name(), "error", err)
+			continue
+		}
+		slog.Info("Backed up database", "database", manifest.Database, "snapshot", manifest.ID)
+
+		if err := backup.Prune(*backupDir, db.Name(), *backupKeep); err != nil {
+			slog.Error("Pruning backups failed", "database", db.Name(), "error", err)
+		}
+	}
+}
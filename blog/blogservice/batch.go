@@ -0,0 +1,118 @@
+package blogservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const maxBatchWrites = 1000
+
+// batchWriteError is a failed write of a batch. It keeps the error of
+// MongoDB, so that WithTransaction sees its labels and retries the
+// transaction on transient errors.
+type batchWriteError struct {
+	index int
+	err   error
+}
+
+func (e *batchWriteError) Error() string {
+	return fmt.Sprintf("write %d: %v", e.index, e.err)
+}
+
+func (e *batchWriteError) Unwrap() error {
+	return e.err
+}
+
+func (s *server) BatchWriteBlogs(ctx context.Context, req *pb.BatchWriteBlogsRequest) (*pb.BatchWriteBlogsResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	writes := req.GetWrites()
+	if len(writes) > maxBatchWrites {
+		return nil, status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Too many writes in batch: %d > %d", len(writes), maxBatchWrites))
+	}
+
+	// Multi-document transactions require MongoDB to run as a replica set
+	session, err := t.collection.Database().Client().StartSession()
+	if err != nil {
+		return nil, internalError(ctx, "Cannot start MongoDB session: %v", err)
+	}
+	// End the session also when the call was canceled
+	defer session.EndSession(context.Background())
+
+	// The callback may be retried on transient errors, so it must not
+	// have any side effects outside of the transaction.
+	var changed []primitive.ObjectID
+	res, err := session.WithTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		changed = nil
+		results := make([]*pb.BlogWriteResult, 0, len(writes))
+		for i, write := range writes {
+			result, err := s.applyBlogWrite(sessCtx, t.collection, write)
+			if err != nil {
+				return nil, &batchWriteError{index: i, err: err}
+			}
+			id := result.GetDeletedBlogId()
+			if result.GetBlog() != nil {
+				id = result.GetBlog().GetId()
+			}
+			oid, _ := primitive.ObjectIDFromHex(id)
+			changed = append(changed, oid)
+			results = append(results, result)
+		}
+		return results, nil
+	})
+	if err != nil {
+		var writeErr *batchWriteError
+		if errors.As(err, &writeErr) {
+			st := status.Convert(storeError(ctx, writeErr.err))
+			return nil, status.Error(st.Code(), fmt.Sprintf("write %d: %s", writeErr.index, st.Message()))
+		}
+		return nil, internalError(ctx, "Cannot commit transaction in MongoDB: %v", err)
+	}
+
+	results := res.([]*pb.BlogWriteResult)
+	for i, oid := range changed {
+		t.cache.remove(oid)
+		if blog := results[i].GetBlog(); blog != nil {
+			t.related.put(oid, blog.GetTitle(), blog.GetContent())
+		} else {
+			t.related.remove(oid)
+		}
+	}
+	return &pb.BatchWriteBlogsResponse{Results: results}, nil
+}
+
+func (s *Service) applyBlogWrite(ctx context.Context, coll *mongo.Collection, write *pb.BlogWrite) (*pb.BlogWriteResult, error) {
+	switch op := write.GetOp().(type) {
+	case *pb.BlogWrite_Create:
+		data, err := s.createBlogItem(ctx, coll, op.Create, write.GetForce())
+		if err != nil {
+			return nil, err
+		}
+		return &pb.BlogWriteResult{Blog: dataToPb(data)}, nil
+	case *pb.BlogWrite_Update:
+		data, err := s.updateBlogItem(ctx, coll, op.Update, write.GetForce())
+		if err != nil {
+			return nil, err
+		}
+		return &pb.BlogWriteResult{Blog: dataToPb(data)}, nil
+	case *pb.BlogWrite_DeleteBlogId:
+		if _, err := deleteBlogItem(ctx, coll, op.DeleteBlogId); err != nil {
+			return nil, err
+		}
+		return &pb.BlogWriteResult{DeletedBlogId: op.DeleteBlogId}, nil
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Missing write operation")
+	}
+}
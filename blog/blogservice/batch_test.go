@@ -0,0 +1,40 @@
+package blogservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestBatchWriteErrorKeepsLabels(t *testing.T) {
+	conflict := mongo.CommandError{Code: 112, Name: "WriteConflict", Labels: []string{"TransientTransactionError"}}
+	err := error(&batchWriteError{index: 2, err: fmt.Errorf("Cannot update object in MongoDB: %w", conflict)})
+
+	var labeled mongo.LabeledError
+	if !errors.As(err, &labeled) || !labeled.HasErrorLabel("TransientTransactionError") {
+		t.Errorf("batchWriteError lost the TransientTransactionError label of %v", err)
+	}
+}
+
+func TestStoreError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"status error", status.Error(codes.NotFound, "Cannot find blog"), codes.NotFound},
+		{"mongo error", fmt.Errorf("Cannot insert blog in MongoDB: %w", mongo.CommandError{Code: 1}), codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(storeError(context.Background(), tt.err)); got != tt.want {
+				t.Errorf("storeError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package blogservice
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// blogCache is an LRU cache with TTL for blogs looked up by ID.
+// A nil *blogCache is valid and caches nothing, so the cache can be
+// disabled without checks at the call sites.
+//
+// Views of cached blogs are counted in memory, and written to MongoDB
+// by FlushViews, so that a cache hit makes no call to MongoDB.
+type blogCache struct {
+	capacity int
+	ttl      time.Duration
+
+	mu    sync.Mutex
+	order *list.List // Most recently used first
+	items map[primitive.ObjectID]*list.Element
+	views map[primitive.ObjectID]int64 // Counted since the last flush
+
+	hits   int64
+	misses int64
+}
+
+type cacheEntry struct {
+	data    *blogItem
+	expires time.Time
+}
+
+func newBlogCache(capacity int, ttl time.Duration) *blogCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &blogCache{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		items:    make(map[primitive.ObjectID]*list.Element),
+		views:    make(map[primitive.ObjectID]int64),
+	}
+}
+
+// get returns a copy of the cached blog, so callers are free to modify it.
+func (c *blogCache) get(id primitive.ObjectID) (*blogItem, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[id]
+	if ok && time.Now().After(elem.Value.(*cacheEntry).expires) {
+		c.removeElement(elem)
+		ok = false
+	}
+	if !ok {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&c.hits, 1)
+	c.order.MoveToFront(elem)
+	data := *elem.Value.(*cacheEntry).data
+	return &data, true
+}
+
+func (c *blogCache) add(data *blogItem) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	copied := *data
+	entry := &cacheEntry{data: &copied, expires: time.Now().Add(c.ttl)}
+	if elem, ok := c.items[data.Id]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.items[data.Id] = c.order.PushFront(entry)
+	if c.order.Len() > c.capacity {
+		c.removeElement(c.order.Back())
+	}
+}
+
+// incrViews counts a view on a cached blog, without touching its TTL.
+func (c *blogCache) incrViews(id primitive.ObjectID) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.views[id]++
+	if elem, ok := c.items[id]; ok {
+		elem.Value.(*cacheEntry).data.Views++
+	}
+}
+
+// pendingViews returns the views of a blog not yet written to MongoDB.
+func (c *blogCache) pendingViews(id primitive.ObjectID) int64 {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.views[id]
+}
+
+// takeViews returns the views counted since the last call, and starts
+// counting anew.
+func (c *blogCache) takeViews() map[primitive.ObjectID]int64 {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	views := c.views
+	c.views = make(map[primitive.ObjectID]int64)
+	return views
+}
+
+// restoreViews counts views again that could not be written to MongoDB.
+func (c *blogCache) restoreViews(views map[primitive.ObjectID]int64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, n := range views {
+		c.views[id] += n
+	}
+}
+
+func (c *blogCache) remove(id primitive.ObjectID) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[id]; ok {
+		c.removeElement(elem)
+	}
+}
+
+func (c *blogCache) removeElement(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*cacheEntry).data.Id)
+}
+
+// stats returns the number of hits, misses and cached blogs.
+func (c *blogCache) stats() (hits, misses int64, entries int) {
+	if c == nil {
+		return 0, 0, 0
+	}
+	c.mu.Lock()
+	entries = c.order.Len()
+	c.mu.Unlock()
+	return atomic.LoadInt64(&c.hits), atomic.LoadInt64(&c.misses), entries
+}
@@ -0,0 +1,51 @@
+package blogservice
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// unreachableCollection returns a collection of a MongoDB server that
+// does not exist, so that every call on it fails.
+func unreachableCollection(t *testing.T) *mongo.Collection {
+	t.Helper()
+	opts := options.Client().ApplyURI("mongodb://127.0.0.1:1").SetServerSelectionTimeout(100 * time.Millisecond)
+	client, err := mongo.Connect(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect(context.Background()) })
+	return client.Database("blogDB").Collection("blog")
+}
+
+func TestReadBlogCacheHitSkipsMongoDB(t *testing.T) {
+	coll := unreachableCollection(t)
+	cache := newBlogCache(10, time.Minute)
+	blog := &blogItem{Id: primitive.NewObjectID(), Title: "Hi", Views: 3}
+	cache.add(blog)
+
+	s := &server{&Service{tenants: &tenantStore{tenants: map[string]*tenant{
+		"": {collection: coll, cache: cache},
+	}}}}
+	for want := int64(4); want <= 5; want++ {
+		res, err := s.ReadBlog(context.Background(), &pb.ReadBlogRequest{BlogId: blog.Id.Hex()})
+		if err != nil {
+			t.Fatalf("ReadBlog() made a call to MongoDB: %v", err)
+		}
+		if got := res.GetBlog().GetViews(); got != want {
+			t.Errorf("ReadBlog() views = %d, want %d", got, want)
+		}
+	}
+
+	// The views cannot be written, so they are kept for the next flush
+	s.FlushViews(context.Background())
+	if got := cache.pendingViews(blog.Id); got != 2 {
+		t.Errorf("pendingViews() = %d after a failed flush, want 2", got)
+	}
+}
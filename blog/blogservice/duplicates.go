@@ -0,0 +1,177 @@
+package blogservice
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"unicode"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// shingleSize is the number of consecutive words hashed together
+	shingleSize = 3
+	// maxDuplicateDistance is the largest number of differing fingerprint
+	// bits for two contents to count as near-duplicates. Unrelated contents
+	// differ in about half of the 64 bits, while a few edited words in a
+	// short post flip around ten of them.
+	maxDuplicateDistance = 12
+)
+
+// fingerprint computes the 64-bit SimHash of the shingles of content.
+// Similar contents get fingerprints that differ in only a few bits.
+// It returns false for contents without any words.
+func fingerprint(content string) (int64, bool) {
+	words := strings.FieldsFunc(strings.ToLower(content), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return 0, false
+	}
+
+	var weights [64]int
+	for i := 0; i+shingleSize <= len(words) || i == 0; i++ {
+		end := i + shingleSize
+		if end > len(words) {
+			end = len(words)
+		}
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(words[i:end], " ")))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<uint(bit)) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var hash uint64
+	for bit, weight := range weights {
+		if weight > 0 {
+			hash |= 1 << uint(bit)
+		}
+	}
+	// MongoDB has no unsigned integers, the bits are stored as they are
+	return int64(hash), true
+}
+
+func fingerprintDistance(a, b int64) int {
+	return bits.OnesCount64(uint64(a) ^ uint64(b))
+}
+
+// findDuplicate returns the ID of a blog, other than exclude, whose content
+// nearly matches the fingerprint. MongoDB cannot compare fingerprints bit by
+// bit, so all fingerprints are scanned, which is cheap compared to the contents.
+func findDuplicate(ctx context.Context, coll *mongo.Collection, fp int64, exclude primitive.ObjectID) (primitive.ObjectID, bool, error) {
+	filter := bson.M{"fingerprint": bson.M{"$exists": true}, "_id": bson.M{"$ne": exclude}}
+	cur, err := coll.Find(ctx, filter, options.Find().SetProjection(bson.M{"fingerprint": 1}))
+	if err != nil {
+		return primitive.NilObjectID, false, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		data := &blogItem{}
+		if err := cur.Decode(data); err != nil {
+			return primitive.NilObjectID, false, err
+		}
+		if fingerprintDistance(fp, *data.Fingerprint) <= maxDuplicateDistance {
+			return data.Id, true, nil
+		}
+	}
+	return primitive.NilObjectID, false, cur.Err()
+}
+
+// checkDuplicate fingerprints the content of data and rejects it if it nearly
+// matches another blog. With force, the blog is flagged as a duplicate instead.
+func checkDuplicate(ctx context.Context, coll *mongo.Collection, data *blogItem, force bool) error {
+	data.Fingerprint = nil
+	data.DuplicateOf = ""
+
+	fp, ok := fingerprint(data.Content)
+	if !ok {
+		return nil
+	}
+	data.Fingerprint = &fp
+
+	duplicate, found, err := findDuplicate(ctx, coll, fp, data.Id)
+	if err != nil {
+		return fmt.Errorf("Cannot check for duplicates in MongoDB: %w", err)
+	}
+	if !found {
+		return nil
+	}
+	if !force {
+		return status.Error(
+			codes.AlreadyExists,
+			fmt.Sprintf("Content nearly matches blog %s, use force to write it anyway", duplicate.Hex()))
+	}
+	data.DuplicateOf = duplicate.Hex()
+	return nil
+}
+
+func (s *adminServer) ListDuplicateClusters(ctx context.Context, req *pb.ListDuplicateClustersRequest) (*pb.ListDuplicateClustersResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	projection := bson.M{"author_id": 1, "title": 1, "slug": 1, "fingerprint": 1, "duplicate_of": 1, "created_at": 1}
+	cur, err := t.collection.Find(ctx,
+		bson.M{"fingerprint": bson.M{"$exists": true}},
+		options.Find().SetProjection(projection).SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, internalError(ctx, "Cannot read fingerprints from MongoDB: %v", err)
+	}
+	items := []*blogItem{}
+	if err := cur.All(ctx, &items); err != nil {
+		return nil, internalError(ctx, "Error decoding data from MongoDB: %v", err)
+	}
+
+	// Union-find over all pairs of near-duplicates
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range items {
+		for j := i + 1; j < len(items); j++ {
+			if fingerprintDistance(*items[i].Fingerprint, *items[j].Fingerprint) <= maxDuplicateDistance {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	clusters := map[int]*pb.DuplicateCluster{}
+	res := &pb.ListDuplicateClustersResponse{}
+	for i, data := range items {
+		root := find(i)
+		cluster, ok := clusters[root]
+		if !ok {
+			cluster = &pb.DuplicateCluster{}
+			clusters[root] = cluster
+		}
+		cluster.Blogs = append(cluster.Blogs, dataToPb(data))
+		if len(cluster.Blogs) == 2 {
+			res.Clusters = append(res.Clusters, cluster)
+		}
+	}
+	return res, nil
+}
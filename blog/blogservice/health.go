@@ -0,0 +1,57 @@
+package blogservice
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var healthInterval = flag.Duration("health-interval", 10*time.Second, "Time between the MongoDB pings of the health checks")
+
+// serviceNames are the services reported by the health checks.
+var serviceNames = []string{"blog.BlogService", "blog.BlogAdminService"}
+
+// MonitorHealth pings MongoDB every health interval, until ctx is canceled,
+// and reports the blog services as NOT_SERVING while the ping fails.
+func (s *Service) MonitorHealth(ctx context.Context, hs *health.Server) {
+	ticker := time.NewTicker(*healthInterval)
+	defer ticker.Stop()
+
+	serving := true
+	for {
+		err := s.ping(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if (err == nil) != serving {
+			serving = err == nil
+			status := healthpb.HealthCheckResponse_SERVING
+			if !serving {
+				status = healthpb.HealthCheckResponse_NOT_SERVING
+				slog.Error("MongoDB ping failed, the blog services are not serving", "error", err)
+			} else {
+				slog.Info("MongoDB ping succeeded, the blog services are serving again")
+			}
+			for _, name := range serviceNames {
+				hs.SetServingStatus(name, status)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ping checks the connection to MongoDB, allowing at most one health interval.
+func (s *Service) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, *healthInterval)
+	defer cancel()
+	return s.client.Ping(ctx, nil)
+}
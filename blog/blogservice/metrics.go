@@ -0,0 +1,36 @@
+package blogservice
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.mongodb.org/mongo-driver/event"
+)
+
+var (
+	mongoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "blog_mongo_command_duration_seconds",
+		Help:    "Duration of the MongoDB commands of the blog service.",
+		Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"command"})
+	mongoErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "blog_mongo_command_errors_total",
+		Help: "Number of failed MongoDB commands of the blog service.",
+	}, []string{"command"})
+)
+
+// mongoMonitor traces every MongoDB command, and records its duration and failures.
+var mongoMonitor = &event.CommandMonitor{
+	Started: startMongoSpan,
+	Succeeded: func(_ context.Context, e *event.CommandSucceededEvent) {
+		mongoDuration.WithLabelValues(e.CommandName).Observe(e.Duration.Seconds())
+		endMongoSpan(e.RequestID, nil)
+	},
+	Failed: func(_ context.Context, e *event.CommandFailedEvent) {
+		mongoDuration.WithLabelValues(e.CommandName).Observe(e.Duration.Seconds())
+		mongoErrors.WithLabelValues(e.CommandName).Inc()
+		endMongoSpan(e.RequestID, errors.New(e.Failure))
+	},
+}
@@ -0,0 +1,182 @@
+package blogservice
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migration is a single step in the evolution of the blog schema.
+// Every step must be idempotent, since a crash between running a step
+// and recording its version makes it run again on the next startup.
+type migration struct {
+	version     int
+	description string
+	up          func(ctx context.Context, coll *mongo.Collection) error
+}
+
+// migrations are applied in order, new steps are appended at the end.
+var migrations = []migration{
+	{1, "backfill timestamps from object ids", backfillTimestamps},
+	{2, "backfill counters and tags", backfillCounters},
+	{3, "backfill slugs", backfillSlugs},
+	{4, "backfill content fingerprints", backfillFingerprints},
+}
+
+// schemaVersion is stored in the schema_migrations collection,
+// with one document per migrated collection.
+type schemaVersion struct {
+	Collection string    `bson:"_id"`
+	Version    int       `bson:"version"`
+	UpdatedAt  time.Time `bson:"updated_at"`
+}
+
+// migrate brings the blog collection up to the latest schema version and
+// makes sure that all indexes exist.
+func migrate(ctx context.Context, coll *mongo.Collection) error {
+	versions := coll.Database().Collection("schema_migrations")
+
+	current := &schemaVersion{}
+	err := versions.FindOne(ctx, bson.M{"_id": coll.Name()}).Decode(current)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return fmt.Errorf("cannot read schema version: %v", err)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current.Version {
+			continue
+		}
+		slog.Info("Applying migration", "collection", coll.Name(), "version", m.version, "description", m.description)
+		if err := m.up(ctx, coll); err != nil {
+			return fmt.Errorf("migration %d failed: %v", m.version, err)
+		}
+		_, err := versions.UpdateOne(ctx,
+			bson.M{"_id": coll.Name()},
+			bson.M{"$set": bson.M{"version": m.version, "updated_at": time.Now().UTC()}},
+			options.Update().SetUpsert(true))
+		if err != nil {
+			return fmt.Errorf("cannot record schema version %d: %v", m.version, err)
+		}
+		current.Version = m.version
+	}
+
+	return ensureIndexes(ctx, coll)
+}
+
+// ensureIndexes creates the indexes used by the queries of the server.
+// Creating an index that already exists is a no-op in MongoDB.
+func ensureIndexes(ctx context.Context, coll *mongo.Collection) error {
+	indexes := []mongo.IndexModel{
+		{Keys: bson.D{{Key: "author_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "updated_at", Value: -1}}},
+		{Keys: bson.D{{Key: "reaction_count", Value: -1}, {Key: "views", Value: -1}}},
+		{Keys: bson.D{{Key: "title", Value: "text"}, {Key: "content", Value: "text"}}},
+		{Keys: bson.D{{Key: "slug", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "moderation", Value: 1}, {Key: "updated_at", Value: 1}}},
+	}
+	if _, err := coll.Indexes().CreateMany(ctx, indexes); err != nil {
+		return fmt.Errorf("cannot create indexes: %v", err)
+	}
+	return nil
+}
+
+// backfillTimestamps derives missing timestamps from the creation time
+// embedded in the object id.
+func backfillTimestamps(ctx context.Context, coll *mongo.Collection) error {
+	_, err := coll.UpdateMany(ctx,
+		bson.M{"created_at": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"created_at": bson.M{"$toDate": "$_id"}}}}})
+	if err != nil {
+		return err
+	}
+	_, err = coll.UpdateMany(ctx,
+		bson.M{"updated_at": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"updated_at": "$created_at"}}}})
+	return err
+}
+
+func backfillCounters(ctx context.Context, coll *mongo.Collection) error {
+	defaults := bson.M{
+		"views":          0,
+		"reaction_count": 0,
+		"tags":           bson.A{},
+	}
+	for field, value := range defaults {
+		_, err := coll.UpdateMany(ctx,
+			bson.M{field: bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{field: value}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func backfillSlugs(ctx context.Context, coll *mongo.Collection) error {
+	cur, err := coll.Find(ctx,
+		bson.M{"slug": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"title": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		data := &blogItem{}
+		if err := cur.Decode(data); err != nil {
+			return err
+		}
+		_, err := coll.UpdateOne(ctx,
+			bson.M{"_id": data.Id},
+			bson.M{"$set": bson.M{"slug": slugify(data.Title, data.Id)}})
+		if err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func backfillFingerprints(ctx context.Context, coll *mongo.Collection) error {
+	cur, err := coll.Find(ctx,
+		bson.M{"fingerprint": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"content": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		data := &blogItem{}
+		if err := cur.Decode(data); err != nil {
+			return err
+		}
+		fp, ok := fingerprint(data.Content)
+		if !ok {
+			continue
+		}
+		_, err := coll.UpdateOne(ctx,
+			bson.M{"_id": data.Id},
+			bson.M{"$set": bson.M{"fingerprint": fp}})
+		if err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// slugify builds a URL friendly name for a blog. The title alone is not
+// unique, so it is suffixed with the whole object id. Parts of the id are
+// not unique either: blogs created in the same second share the timestamp
+// and others may share the counter.
+func slugify(title string, id primitive.ObjectID) string {
+	words := append(splitWords(title), id.Hex())
+	return strings.Join(words, "-")
+}
@@ -0,0 +1,20 @@
+package blogservice
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSlugify(t *testing.T) {
+	id, _ := primitive.ObjectIDFromHex("5f1d7f0c0a1b2c3d4e000001")
+	if got, want := slugify("Hello, World!", id), "hello-world-5f1d7f0c0a1b2c3d4e000001"; got != want {
+		t.Errorf("slugify() = %q, want %q", got, want)
+	}
+
+	// Ids of different processes may share the counter
+	other, _ := primitive.ObjectIDFromHex("5f1d7f0d0f0e0d0c0b000001")
+	if slugify("Hello", id) == slugify("Hello", other) {
+		t.Errorf("slugify() is the same for ids %s and %s", id.Hex(), other.Hex())
+	}
+}
@@ -0,0 +1,248 @@
+package blogservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Actions of moderation rules, from the weakest to the strongest.
+const (
+	actionFlag   = "flag"   // Publish, but list in the moderation queue
+	actionHold   = "hold"   // Hide until a moderator approves
+	actionReject = "reject" // Refuse to write the blog
+)
+
+var actionStrength = map[string]int{actionFlag: 1, actionHold: 2, actionReject: 3}
+
+var linkPattern = regexp.MustCompile(`(?i)https?://`)
+
+// hiddenModeration are the moderation states of blogs hidden from listings.
+var hiddenModeration = bson.A{
+	pb.ModerationStatus_PENDING_REVIEW.String(),
+	pb.ModerationStatus_REJECTED.String(),
+}
+
+// isHidden reports whether a blog in the moderation state is hidden.
+func isHidden(moderation string) bool {
+	for _, state := range hiddenModeration {
+		if state == moderation {
+			return true
+		}
+	}
+	return false
+}
+
+// moderationRule is a single rule of the moderation config file.
+type moderationRule struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"` // banned_words, regex, max_links or max_length
+	Action  string   `json:"action"`
+	Words   []string `json:"words,omitempty"`   // banned_words
+	Pattern string   `json:"pattern,omitempty"` // regex
+	Max     int      `json:"max,omitempty"`     // max_links and max_length
+
+	phrases [][]string // Banned words and phrases, split into words
+	regexp  *regexp.Regexp
+}
+
+// moderator checks blogs against a set of rules. A nil *moderator
+// accepts everything.
+type moderator struct {
+	Rules []*moderationRule `json:"rules"`
+}
+
+// loadModerator reads the moderation rules from a JSON file.
+func loadModerator(path string) (*moderator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &moderator{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("invalid moderation rules in %s: %v", path, err)
+	}
+
+	for i, rule := range m.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if _, ok := actionStrength[rule.Action]; !ok {
+			return nil, fmt.Errorf("%s: unknown action %q", rule.Name, rule.Action)
+		}
+		switch rule.Type {
+		case "banned_words":
+			for _, word := range rule.Words {
+				if phrase := splitWords(word); len(phrase) > 0 {
+					rule.phrases = append(rule.phrases, phrase)
+				}
+			}
+		case "regex":
+			if rule.regexp, err = regexp.Compile(rule.Pattern); err != nil {
+				return nil, fmt.Errorf("%s: %v", rule.Name, err)
+			}
+		case "max_links", "max_length":
+		default:
+			return nil, fmt.Errorf("%s: unknown type %q", rule.Name, rule.Type)
+		}
+	}
+	return m, nil
+}
+
+func (r *moderationRule) matches(data *blogItem) bool {
+	switch r.Type {
+	case "banned_words":
+		// All words count, also stop words and single letters
+		words := splitWords(data.Title + " " + data.Content)
+		for _, phrase := range r.phrases {
+			if containsPhrase(words, phrase) {
+				return true
+			}
+		}
+		return false
+	case "regex":
+		return r.regexp.MatchString(data.Title + "\n" + data.Content)
+	case "max_links":
+		return len(linkPattern.FindAllStringIndex(data.Content, -1)) > r.Max
+	case "max_length":
+		return utf8.RuneCountInString(data.Content) > r.Max
+	}
+	return false
+}
+
+// containsPhrase reports whether the words of phrase follow each other in words.
+func containsPhrase(words []string, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		if slices.Equal(words[i:i+len(phrase)], phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+// check runs all rules on data and sets its moderation state according to
+// the strongest action of the matching rules. Edited blogs that are held or
+// rejected stay so until they are reviewed.
+func (m *moderator) check(data *blogItem) error {
+	previous := data.Moderation
+	data.ModerationReasons = nil
+
+	action := ""
+	if m != nil {
+		for _, rule := range m.Rules {
+			if !rule.matches(data) {
+				continue
+			}
+			data.ModerationReasons = append(data.ModerationReasons, rule.Name)
+			if actionStrength[rule.Action] > actionStrength[action] {
+				action = rule.Action
+			}
+		}
+	}
+
+	checked := ""
+	switch action {
+	case actionReject:
+		return status.Errorf(
+			codes.InvalidArgument,
+			"Blog rejected by moderation: %s", strings.Join(data.ModerationReasons, ", "))
+	case actionHold:
+		checked = pb.ModerationStatus_PENDING_REVIEW.String()
+	case actionFlag:
+		checked = pb.ModerationStatus_FLAGGED.String()
+	}
+	data.Moderation = editedModeration(previous, checked)
+	return nil
+}
+
+// editedModeration returns the moderation state of a blog edited from
+// the previous state, with checked the state of the new content. Only
+// ReviewBlog takes a blog out of review or rejection.
+func editedModeration(previous string, checked string) string {
+	switch previous {
+	case pb.ModerationStatus_PENDING_REVIEW.String(), pb.ModerationStatus_REJECTED.String():
+		return previous
+	}
+	return checked
+}
+
+func (s *adminServer) ListModerationQueue(ctx context.Context, req *pb.ListModerationQueueRequest) (*pb.ListModerationQueueResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Oldest first, so moderators work through the queue in order
+	filter := bson.M{"moderation": bson.M{"$in": bson.A{
+		pb.ModerationStatus_PENDING_REVIEW.String(),
+		pb.ModerationStatus_FLAGGED.String(),
+	}}}
+	cur, err := t.collection.Find(ctx, filter, options.Find().SetSort(bson.M{"updated_at": 1}))
+	if err != nil {
+		return nil, internalError(ctx, "Cannot read moderation queue from MongoDB: %v", err)
+	}
+	items := []*blogItem{}
+	if err := cur.All(ctx, &items); err != nil {
+		return nil, internalError(ctx, "Error decoding data from MongoDB: %v", err)
+	}
+
+	res := &pb.ListModerationQueueResponse{}
+	for _, data := range items {
+		res.Blogs = append(res.Blogs, dataToPb(data))
+	}
+	return res, nil
+}
+
+func (s *adminServer) ReviewBlog(ctx context.Context, req *pb.ReviewBlogRequest) (*pb.ReviewBlogResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Cannot parse ID: %v\n", err))
+	}
+
+	var update bson.M
+	switch req.GetDecision() {
+	case pb.ReviewBlogRequest_APPROVE:
+		update = bson.M{"$unset": bson.M{"moderation": "", "moderation_reasons": ""}}
+	case pb.ReviewBlogRequest_REJECT:
+		update = bson.M{"$set": bson.M{"moderation": pb.ModerationStatus_REJECTED.String()}}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "Missing review decision")
+	}
+	if note := req.GetNote(); note != "" {
+		update["$push"] = bson.M{"review_notes": note}
+	}
+
+	data := &blogItem{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = t.collection.FindOneAndUpdate(ctx, bson.M{"_id": oid}, update, opts).Decode(data)
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Error(
+			codes.NotFound,
+			fmt.Sprintf("Cannot find blog with specified ID: %v", err))
+	}
+	if err != nil {
+		return nil, internalError(ctx, "Cannot review blog in MongoDB: %v", err)
+	}
+	t.cache.remove(oid)
+	return &pb.ReviewBlogResponse{Blog: dataToPb(data)}, nil
+}
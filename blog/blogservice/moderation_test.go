@@ -0,0 +1,124 @@
+package blogservice
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func testModerator() *moderator {
+	return &moderator{Rules: []*moderationRule{
+		{Name: "banned words", Type: "banned_words", Action: actionReject, phrases: [][]string{{"casino"}}},
+		{Name: "too many links", Type: "max_links", Action: actionHold, Max: 1},
+		{Name: "links", Type: "regex", Action: actionFlag, regexp: linkPattern},
+	}}
+}
+
+func TestCheckKeepsReviewStateOnUpdate(t *testing.T) {
+	var (
+		published = ""
+		flagged   = pb.ModerationStatus_FLAGGED.String()
+		pending   = pb.ModerationStatus_PENDING_REVIEW.String()
+		rejected  = pb.ModerationStatus_REJECTED.String()
+	)
+	clean := "A post about gardening"
+	flag := "See http://example.com"
+	hold := strings.Repeat("See http://example.com ", 2)
+
+	tests := []struct {
+		name     string
+		previous string
+		content  string
+		want     string
+	}{
+		{"new clean blog", published, clean, published},
+		{"new held blog", published, hold, pending},
+		{"flagged blog cleaned up", flagged, clean, published},
+		{"flagged blog held", flagged, hold, pending},
+		{"published blog flagged", published, flag, flagged},
+		{"held blog cleaned up", pending, clean, pending},
+		{"held blog flagged", pending, flag, pending},
+		{"rejected blog cleaned up", rejected, clean, rejected},
+		{"rejected blog held", rejected, hold, rejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &blogItem{Content: tt.content, Moderation: tt.previous}
+			if err := testModerator().check(data); err != nil {
+				t.Fatalf("check() = %v", err)
+			}
+			if data.Moderation != tt.want {
+				t.Errorf("moderation = %q, want %q", data.Moderation, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWithoutRulesKeepsReviewState(t *testing.T) {
+	var m *moderator
+	data := &blogItem{Content: "casino", Moderation: pb.ModerationStatus_REJECTED.String()}
+	if err := m.check(data); err != nil {
+		t.Fatalf("check() = %v", err)
+	}
+	if want := pb.ModerationStatus_REJECTED.String(); data.Moderation != want {
+		t.Errorf("moderation = %q, want %q", data.Moderation, want)
+	}
+}
+
+func TestCheckRejects(t *testing.T) {
+	data := &blogItem{Content: "Win at the casino"}
+	err := testModerator().check(data)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("check() = %v, want %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestBannedWordsMatchAllWords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "moderation.json")
+	rules := `{"rules": [{"type": "banned_words", "action": "flag", "words": ["The", "x", "buy now"]}]}`
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loadModerator(path)
+	if err != nil {
+		t.Fatalf("loadModerator() = %v", err)
+	}
+
+	tests := []struct {
+		content string
+		want    bool
+	}{
+		{"Read the post", true},      // Stop word
+		{"Follow me on X", true},     // Single letter
+		{"Buy now, pay later", true}, // Phrase
+		{"Buy it now", false},        // Words of the phrase apart
+		{"A post about xylophones", false},
+	}
+	for _, tt := range tests {
+		if got := m.Rules[0].matches(&blogItem{Content: tt.content}); got != tt.want {
+			t.Errorf("matches(%q) = %v, want %v", tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestReadBlogHidesCachedHeldBlog(t *testing.T) {
+	cache := newBlogCache(10, time.Minute)
+	blog := &blogItem{Id: primitive.NewObjectID(), Moderation: pb.ModerationStatus_PENDING_REVIEW.String()}
+	cache.add(blog)
+
+	s := &server{&Service{tenants: &tenantStore{tenants: map[string]*tenant{
+		"": {collection: unreachableCollection(t), cache: cache},
+	}}}}
+	_, err := s.ReadBlog(context.Background(), &pb.ReadBlogRequest{BlogId: blog.Id.Hex()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("ReadBlog() = %v, want %v", err, codes.NotFound)
+	}
+}
@@ -0,0 +1,243 @@
+package blogservice
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultRelatedLimit = 5
+	maxRelatedLimit     = 50
+	// titleWeight counts every word of the title this many times
+	titleWeight = 3
+)
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "from": true, "has": true,
+	"have": true, "i": true, "in": true, "is": true, "it": true, "its": true,
+	"of": true, "on": true, "or": true, "that": true, "the": true, "this": true,
+	"to": true, "was": true, "we": true, "were": true, "will": true, "with": true,
+	"you": true,
+}
+
+// splitWords splits text into lower case words.
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// tokenize splits text into lower case words, without stop words.
+func tokenize(text string) []string {
+	words := splitWords(text)
+	tokens := words[:0]
+	for _, word := range words {
+		if len(word) > 1 && !stopWords[word] {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+// relatedIndex is an in-memory TF-IDF index over the titles and contents
+// of the blogs of a tenant. It is kept up to date by the write RPCs.
+type relatedIndex struct {
+	mu       sync.RWMutex
+	terms    map[primitive.ObjectID]map[string]float64 // Term frequencies of each blog
+	postings map[string]map[primitive.ObjectID]bool    // Blogs containing each term
+}
+
+type relatedBlog struct {
+	id    primitive.ObjectID
+	score float64
+}
+
+func newRelatedIndex() *relatedIndex {
+	return &relatedIndex{
+		terms:    make(map[primitive.ObjectID]map[string]float64),
+		postings: make(map[string]map[primitive.ObjectID]bool),
+	}
+}
+
+// load indexes all blogs in the collection.
+func (idx *relatedIndex) load(ctx context.Context, coll *mongo.Collection) error {
+	cur, err := coll.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"title": 1, "content": 1}))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		data := &blogItem{}
+		if err := cur.Decode(data); err != nil {
+			return err
+		}
+		idx.put(data.Id, data.Title, data.Content)
+	}
+	return cur.Err()
+}
+
+func (idx *relatedIndex) put(id primitive.ObjectID, title string, content string) {
+	tf := map[string]float64{}
+	for _, token := range tokenize(title) {
+		tf[token] += titleWeight
+	}
+	for _, token := range tokenize(content) {
+		tf[token]++
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(id)
+	idx.terms[id] = tf
+	for term := range tf {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[primitive.ObjectID]bool)
+		}
+		idx.postings[term][id] = true
+	}
+}
+
+func (idx *relatedIndex) remove(id primitive.ObjectID) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.removeLocked(id)
+}
+
+func (idx *relatedIndex) removeLocked(id primitive.ObjectID) {
+	for term := range idx.terms[id] {
+		delete(idx.postings[term], id)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+	delete(idx.terms, id)
+}
+
+// related returns up to limit blogs most similar to the blog with the
+// given id, by cosine similarity of their TF-IDF vectors.
+func (idx *relatedIndex) related(id primitive.ObjectID, limit int) ([]relatedBlog, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	query, ok := idx.terms[id]
+	if !ok {
+		return nil, false
+	}
+
+	// Only blogs sharing at least one term can have a positive score
+	scores := map[primitive.ObjectID]float64{}
+	for term, tf := range query {
+		weight := tf * idx.idf(term)
+		for other := range idx.postings[term] {
+			if other != id {
+				scores[other] += weight * idx.terms[other][term] * idx.idf(term)
+			}
+		}
+	}
+
+	results := make([]relatedBlog, 0, len(scores))
+	queryNorm := idx.norm(query)
+	for other, dot := range scores {
+		results = append(results, relatedBlog{id: other, score: dot / (queryNorm * idx.norm(idx.terms[other]))})
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].id.Hex() < results[j].id.Hex()
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, true
+}
+
+func (idx *relatedIndex) idf(term string) float64 {
+	return math.Log(1 + float64(len(idx.terms))/float64(len(idx.postings[term])))
+}
+
+func (idx *relatedIndex) norm(tf map[string]float64) float64 {
+	sum := 0.0
+	for term, f := range tf {
+		w := f * idx.idf(term)
+		sum += w * w
+	}
+	return math.Sqrt(sum)
+}
+
+func (s *server) ListRelatedBlogs(ctx context.Context, req *pb.ListRelatedBlogsRequest) (*pb.ListRelatedBlogsResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Cannot parse ID: %v\n", err))
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultRelatedLimit
+	}
+	if limit > maxRelatedLimit {
+		limit = maxRelatedLimit
+	}
+
+	related, ok := t.related.related(oid, limit)
+	if !ok {
+		return nil, status.Error(
+			codes.NotFound,
+			fmt.Sprintf("Cannot find blog with specified ID: %v", req.GetBlogId()))
+	}
+	if len(related) == 0 {
+		return &pb.ListRelatedBlogsResponse{}, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(related))
+	for _, r := range related {
+		ids = append(ids, r.id)
+	}
+	cur, err := t.collection.Find(ctx, bson.M{
+		"_id":        bson.M{"$in": ids},
+		"moderation": bson.M{"$nin": hiddenModeration},
+	})
+	if err != nil {
+		return nil, internalError(ctx, "Cannot read related blogs from MongoDB: %v", err)
+	}
+	blogs := map[primitive.ObjectID]*blogItem{}
+	items := []*blogItem{}
+	if err := cur.All(ctx, &items); err != nil {
+		return nil, internalError(ctx, "Error decoding data from MongoDB: %v", err)
+	}
+	for _, data := range items {
+		blogs[data.Id] = data
+	}
+
+	// Keep the order by score, skipping hidden blogs and blogs deleted in the meantime
+	res := &pb.ListRelatedBlogsResponse{}
+	for _, r := range related {
+		if data, ok := blogs[r.id]; ok {
+			res.Blogs = append(res.Blogs, &pb.RelatedBlog{Blog: dataToPb(data), Score: r.score})
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,482 @@
+package blogservice
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// server implements BlogService.
+type server struct {
+	*Service
+}
+
+type blogItem struct {
+	Id            primitive.ObjectID `bson:"_id,omitempty"`
+	AuthorId      string             `bson:"author_id"`
+	Content       string             `bson:"content"`
+	Title         string             `bson:"title"`
+	Slug          string             `bson:"slug"`
+	Views         int64              `bson:"views"`
+	ReactionCount int64              `bson:"reaction_count"`
+	Reactions     map[string]string  `bson:"reactions,omitempty"` // user id -> reaction
+	Tags          []string           `bson:"tags"`
+	CreatedAt     time.Time          `bson:"created_at"`
+	UpdatedAt     time.Time          `bson:"updated_at"`
+	Fingerprint   *int64             `bson:"fingerprint,omitempty"`  // SimHash of the content
+	DuplicateOf   string             `bson:"duplicate_of,omitempty"` // Set when forced past the duplicate check
+
+	// Moderation is the name of a pb.ModerationStatus, missing if published
+	Moderation        string   `bson:"moderation,omitempty"`
+	ModerationReasons []string `bson:"moderation_reasons,omitempty"`
+	ReviewNotes       []string `bson:"review_notes,omitempty"`
+}
+
+const defaultReaction = "like"
+
+func (s *server) CreateBlog(ctx context.Context, req *pb.CreateBlogRequest) (*pb.CreateBlogResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.createBlogItem(ctx, t.collection, req.GetBlog(), req.GetForce())
+	if err != nil {
+		return nil, storeError(ctx, err)
+	}
+	t.related.put(data.Id, data.Title, data.Content)
+	return &pb.CreateBlogResponse{Blog: dataToPb(data)}, nil
+}
+
+func (s *server) ReadBlog(ctx context.Context, req *pb.ReadBlogRequest) (*pb.ReadBlogResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	blogID := req.GetBlogId()
+	oid, err := primitive.ObjectIDFromHex(blogID)
+	if err != nil {
+		return nil, status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Cannot parse ID: %v\n", err))
+	}
+
+	// The view of a cached blog is counted in memory, see FlushViews
+	if data, ok := t.cache.get(oid); ok {
+		if isHidden(data.Moderation) {
+			return nil, status.Error(
+				codes.NotFound,
+				fmt.Sprintf("Cannot find blog with specified ID: %v", blogID))
+		}
+		t.cache.incrViews(oid)
+		data.Views++
+		return &pb.ReadBlogResponse{Blog: dataToPb(data)}, nil
+	}
+
+	// Count the view and fetch the updated blog in one atomic operation.
+	// Blogs hidden by moderation are not found.
+	data := &blogItem{}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	filter := bson.M{"_id": oid, "moderation": bson.M{"$nin": hiddenModeration}}
+	res := t.collection.FindOneAndUpdate(ctx, filter, bson.M{"$inc": bson.M{"views": 1}}, opts)
+	if err := res.Decode(data); err == mongo.ErrNoDocuments {
+		return nil, status.Error(
+			codes.NotFound,
+			fmt.Sprintf("Cannot find blog with specified ID: %v", err))
+	} else if err != nil {
+		return nil, internalError(ctx, "Cannot read blog from MongoDB: %v", err)
+	}
+	data.Views += t.cache.pendingViews(oid)
+	t.cache.add(data)
+
+	return &pb.ReadBlogResponse{Blog: dataToPb(data)}, nil
+}
+
+func (s *server) UpdateBlog(ctx context.Context, req *pb.UpdateBlogRequest) (*pb.UpdateBlogResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.updateBlogItem(ctx, t.collection, req.GetBlog(), req.GetForce())
+	if err != nil {
+		return nil, storeError(ctx, err)
+	}
+	t.cache.remove(data.Id)
+	t.related.put(data.Id, data.Title, data.Content)
+	return &pb.UpdateBlogResponse{Blog: dataToPb(data)}, nil
+}
+
+func (s *server) DeleteBlog(ctx context.Context, req *pb.DeleteBlogRequest) (*pb.DeleteBlogResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	oid, err := deleteBlogItem(ctx, t.collection, req.GetBlogId())
+	if err != nil {
+		return nil, storeError(ctx, err)
+	}
+	t.cache.remove(oid)
+	t.related.remove(oid)
+	return &pb.DeleteBlogResponse{BlogId: req.GetBlogId()}, nil
+}
+
+func (s *server) ListBlog(req *pb.ListBlogRequest, stream pb.BlogService_ListBlogServer) error {
+	ctx := stream.Context()
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	findOptions := options.Find()
+	if req.GetSort() == pb.ListBlogRequest_POPULARITY {
+		findOptions.SetSort(bson.D{
+			{Key: "reaction_count", Value: -1},
+			{Key: "views", Value: -1},
+		})
+	}
+
+	// Blogs held for review or rejected by moderation are not listed
+	filter := bson.M{"moderation": bson.M{"$nin": hiddenModeration}}
+	cur, err := t.collection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return internalError(ctx, "Unknown internal error: %v\n", err)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		data := &blogItem{}
+		err := cur.Decode(data)
+		if err != nil {
+			return internalError(ctx, "Error decoding data from MongoDG: %v", err)
+		}
+		if err := stream.Send(&pb.ListBlogResponse{Blog: dataToPb(data)}); err != nil {
+			// The client is gone, there is no point in reading further
+			return sendError(ctx, err)
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return internalError(ctx, "Unknown internal error: %v", err)
+	}
+	return nil
+}
+
+func (s *server) ReactToBlog(ctx context.Context, req *pb.ReactToBlogRequest) (*pb.ReactToBlogResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Cannot parse ID: %v\n", err))
+	}
+	field, err := reactionField(req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+	reaction := req.GetReaction()
+	if reaction == "" {
+		reaction = defaultReaction
+	}
+
+	// A first reaction from the user bumps the counter, while a repeated one
+	// only replaces the kind. The filter makes each case a single atomic update.
+	// Blogs hidden by moderation cannot be reacted to.
+	visible := bson.M{"$nin": hiddenModeration}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	data := &blogItem{}
+	res := t.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": oid, "moderation": visible, field: bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{field: reaction}, "$inc": bson.M{"reaction_count": 1}},
+		opts)
+	err = res.Decode(data)
+	if err == mongo.ErrNoDocuments {
+		res = t.collection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": oid, "moderation": visible},
+			bson.M{"$set": bson.M{field: reaction}},
+			opts)
+		err = res.Decode(data)
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Error(
+			codes.NotFound,
+			fmt.Sprintf("Cannot find blog with specified ID: %v", err))
+	}
+	if err != nil {
+		return nil, internalError(ctx, "Cannot update reaction in MongoDB: %v", err)
+	}
+	t.cache.remove(oid)
+	return &pb.ReactToBlogResponse{Blog: dataToPb(data)}, nil
+}
+
+func (s *server) RemoveReaction(ctx context.Context, req *pb.RemoveReactionRequest) (*pb.RemoveReactionResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	oid, err := primitive.ObjectIDFromHex(req.GetBlogId())
+	if err != nil {
+		return nil, status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Cannot parse ID: %v\n", err))
+	}
+	field, err := reactionField(req.GetUserId())
+	if err != nil {
+		return nil, err
+	}
+
+	// Only decrement the counter if the user actually had a reaction,
+	// otherwise just return the blog as it is. Blogs hidden by moderation
+	// are not found.
+	visible := bson.M{"$nin": hiddenModeration}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	data := &blogItem{}
+	res := t.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": oid, "moderation": visible, field: bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{field: ""}, "$inc": bson.M{"reaction_count": -1}},
+		opts)
+	err = res.Decode(data)
+	if err == mongo.ErrNoDocuments {
+		err = t.collection.FindOne(ctx, bson.M{"_id": oid, "moderation": visible}).Decode(data)
+	}
+	if err == mongo.ErrNoDocuments {
+		return nil, status.Error(
+			codes.NotFound,
+			fmt.Sprintf("Cannot find blog with specified ID: %v", err))
+	}
+	if err != nil {
+		return nil, internalError(ctx, "Cannot remove reaction in MongoDB: %v", err)
+	}
+	t.cache.remove(oid)
+	return &pb.RemoveReactionResponse{Blog: dataToPb(data)}, nil
+}
+
+func (s *server) GetCacheStats(ctx context.Context, req *pb.GetCacheStatsRequest) (*pb.GetCacheStatsResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hits, misses, entries := t.cache.stats()
+	return &pb.GetCacheStatsResponse{
+		Hits:     hits,
+		Misses:   misses,
+		Entries:  int64(entries),
+		Capacity: int64(*cacheSize),
+	}, nil
+}
+
+// reactionField returns the document field holding the reaction of userID.
+// The user id becomes part of a field path, so it cannot contain '.' or '$'.
+func reactionField(userID string) (string, error) {
+	if userID == "" || strings.ContainsAny(userID, ".$") {
+		return "", status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Invalid user ID: %q", userID))
+	}
+	return "reactions." + userID, nil
+}
+
+// createBlogItem inserts a new blog. The write functions are shared by the
+// single and batch RPCs, so they leave the cache and index to the caller.
+// They return the errors of MongoDB unconverted, so that a transaction can
+// be retried on transient ones, see storeError.
+func (s *Service) createBlogItem(ctx context.Context, coll *mongo.Collection, blog *pb.Blog, force bool) (*blogItem, error) {
+	if blog == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Missing blog")
+	}
+	now := time.Now().UTC()
+	oid := primitive.NewObjectID()
+	data := &blogItem{
+		Id:        oid,
+		Slug:      slugify(blog.GetTitle(), oid),
+		AuthorId:  blog.GetAuthorId(),
+		Title:     blog.GetTitle(),
+		Content:   blog.GetContent(),
+		Tags:      blog.GetTags(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.moderation.check(data); err != nil {
+		return nil, err
+	}
+	if err := checkDuplicate(ctx, coll, data, force); err != nil {
+		return nil, err
+	}
+
+	_, err := coll.InsertOne(ctx, data)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot insert blog in MongoDB: %w", err)
+	}
+	return data, nil
+}
+
+func (s *Service) updateBlogItem(ctx context.Context, coll *mongo.Collection, blog *pb.Blog, force bool) (*blogItem, error) {
+	if blog == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "Missing blog")
+	}
+	oid, err := primitive.ObjectIDFromHex(blog.GetId())
+	if err != nil {
+		return nil, status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Cannot parse ID: %v\n", err))
+	}
+
+	// Create an empty struct
+	data := &blogItem{}
+	filter := bson.M{"_id": oid}
+	findRes := coll.FindOne(ctx, filter)
+	if err := findRes.Decode(data); err == mongo.ErrNoDocuments {
+		return nil, status.Error(
+			codes.NotFound,
+			fmt.Sprintf("Cannot find blog with specified ID: %v", err))
+	} else if err != nil {
+		return nil, fmt.Errorf("Cannot read blog from MongoDB: %w", err)
+	}
+
+	// Set the data to be updated
+	data.AuthorId = blog.GetAuthorId()
+	data.Content = blog.GetContent()
+	data.Title = blog.GetTitle()
+	data.Tags = blog.GetTags()
+	data.UpdatedAt = time.Now().UTC()
+	if err := s.moderation.check(data); err != nil {
+		return nil, err
+	}
+	if err := checkDuplicate(ctx, coll, data, force); err != nil {
+		return nil, err
+	}
+
+	// Only set the editable fields, so concurrent views and reactions are kept
+	set := bson.M{
+		"author_id":  data.AuthorId,
+		"content":    data.Content,
+		"title":      data.Title,
+		"tags":       data.Tags,
+		"updated_at": data.UpdatedAt,
+	}
+	unset := bson.M{}
+	if data.Fingerprint != nil {
+		set["fingerprint"] = *data.Fingerprint
+	} else {
+		unset["fingerprint"] = ""
+	}
+	if data.DuplicateOf != "" {
+		set["duplicate_of"] = data.DuplicateOf
+	} else {
+		unset["duplicate_of"] = ""
+	}
+	if data.Moderation != "" {
+		set["moderation"] = data.Moderation
+		set["moderation_reasons"] = data.ModerationReasons
+	} else {
+		unset["moderation"] = ""
+		unset["moderation_reasons"] = ""
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	_, updateErr := coll.UpdateOne(ctx, filter, update)
+	if updateErr != nil {
+		return nil, fmt.Errorf("Cannot update object in MongoDB: %w", updateErr)
+	}
+	return data, nil
+}
+
+func deleteBlogItem(ctx context.Context, coll *mongo.Collection, blogId string) (primitive.ObjectID, error) {
+	oid, err := primitive.ObjectIDFromHex(blogId)
+	if err != nil {
+		return oid, status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Cannot parse ID: %v\n", err))
+	}
+	filter := bson.M{"_id": oid}
+	res, err := coll.DeleteOne(ctx, filter)
+	if err != nil {
+		return oid, fmt.Errorf("Cannot delete object in MongoDB: %w", err)
+	}
+	if res.DeletedCount == 0 {
+		return oid, status.Error(
+			codes.NotFound,
+			fmt.Sprintf("Cannot find blog in MongoDG: %v\n", err))
+	}
+	return oid, nil
+}
+
+// internalError converts a failed store call to a status error. Failures
+// caused by the client canceling the call, or by its deadline, are reported
+// as such instead of as internal errors.
+func internalError(ctx context.Context, format string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	return status.Error(codes.Internal, fmt.Sprintf(format, err))
+}
+
+// storeError converts an error of the write functions to a status error.
+// Status errors are passed on, the errors of MongoDB are internal errors.
+func storeError(ctx context.Context, err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return internalError(ctx, "%v", err)
+}
+
+// sendError converts a failed send on a server stream to a status error.
+func sendError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	return status.Convert(err).Err()
+}
+
+func dataToPb(data *blogItem) *pb.Blog {
+	reactions := map[string]int64{}
+	for _, reaction := range data.Reactions {
+		reactions[reaction]++
+	}
+	return &pb.Blog{
+		Id:                data.Id.Hex(),
+		AuthorId:          data.AuthorId,
+		Content:           data.Content,
+		Title:             data.Title,
+		Slug:              data.Slug,
+		Views:             data.Views,
+		ReactionCount:     data.ReactionCount,
+		Reactions:         reactions,
+		Tags:              data.Tags,
+		CreatedAt:         unixTime(data.CreatedAt),
+		UpdatedAt:         unixTime(data.UpdatedAt),
+		DuplicateOf:       data.DuplicateOf,
+		Moderation:        pb.ModerationStatus(pb.ModerationStatus_value[data.Moderation]),
+		ModerationReasons: data.ModerationReasons,
+		ReviewNotes:       data.ReviewNotes,
+	}
+}
+
+// unixTime converts t to Unix seconds, where a missing time is reported as 0.
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
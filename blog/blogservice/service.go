@@ -0,0 +1,79 @@
+// Package blogservice implements BlogService and BlogAdminService on top
+// of MongoDB, so that they can be served alone or next to other services.
+package blogservice
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"github.com/andreasatle/Udemy/grpc-go-course/interceptor"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"google.golang.org/grpc"
+)
+
+var (
+	mongoURI  = flag.String("mongo-uri", "mongodb://localhost:27017", "MongoDB connection string")
+	database  = flag.String("db", "blogDB", "MongoDB database of the default tenant, other tenants use <db>_<tenant>")
+	cacheSize = flag.Int("cache-size", 0, "Number of blogs kept in the read cache of each tenant, 0 disables the cache")
+	cacheTTL  = flag.Duration("cache-ttl", time.Minute, "How long a blog is kept in the read cache")
+	rulesFile = flag.String("moderation-rules", "", "JSON file with the moderation rules, empty disables moderation")
+)
+
+// MethodLimits are the rate limits of the expensive blog calls, tighter
+// than the default ones. See interceptor.RateLimitConfig.
+var MethodLimits = map[string]interceptor.Limit{
+	"/blog.BlogService/GetBlogStats":    {Rate: 1, Burst: 5},
+	"/blog.BlogService/BatchWriteBlogs": {Rate: 1, Burst: 5},
+}
+
+// Service holds the state shared by the blog handlers.
+type Service struct {
+	client     *mongo.Client
+	tenants    *tenantStore
+	moderation *moderator
+}
+
+// Connect connects to the MongoDB server given by the -mongo-uri flag,
+// recording the commands in the store metrics.
+func Connect(ctx context.Context) (*mongo.Client, error) {
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(*mongoURI).SetMonitor(mongoMonitor))
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		client.Disconnect(ctx)
+		return nil, err
+	}
+	return client, nil
+}
+
+// New loads the moderation rules and the tenants, migrating their databases.
+func New(ctx context.Context, client *mongo.Client) (*Service, error) {
+	if *backupDir != "" && *backupKeep < 1 {
+		return nil, fmt.Errorf("-backup-keep must be at least 1, got %d", *backupKeep)
+	}
+
+	s := &Service{client: client}
+	if *rulesFile != "" {
+		var err error
+		if s.moderation, err = loadModerator(*rulesFile); err != nil {
+			return nil, fmt.Errorf("failed to load moderation rules: %v", err)
+		}
+	}
+
+	s.tenants = newTenantStore(client, *database)
+	if err := s.tenants.load(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load the tenants: %v", err)
+	}
+	return s, nil
+}
+
+// Register registers BlogService and BlogAdminService on the server.
+func (s *Service) Register(gs *grpc.Server) {
+	pb.RegisterBlogServiceServer(gs, &server{s})
+	pb.RegisterBlogAdminServiceServer(gs, &adminServer{s})
+}
@@ -0,0 +1,98 @@
+package blogservice
+
+import (
+	"context"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type statsCount struct {
+	Key   string `bson:"_id"`
+	Count int64  `bson:"count"`
+}
+
+type statsResult struct {
+	Totals []struct {
+		Count         int64   `bson:"count"`
+		AverageLength float64 `bson:"average_length"`
+	} `bson:"totals"`
+	Authors []statsCount `bson:"authors"`
+	Tags    []statsCount `bson:"tags"`
+	Months  []statsCount `bson:"months"`
+}
+
+// statsPipeline computes all statistics in a single pass over the collection,
+// with one $facet sub-pipeline per group of statistics.
+var statsPipeline = mongo.Pipeline{
+	{{Key: "$facet", Value: bson.M{
+		"totals": bson.A{
+			bson.M{"$group": bson.M{
+				"_id":            nil,
+				"count":          bson.M{"$sum": 1},
+				"average_length": bson.M{"$avg": bson.M{"$strLenCP": bson.M{"$ifNull": bson.A{"$content", ""}}}},
+			}},
+		},
+		"authors": bson.A{
+			bson.M{"$group": bson.M{"_id": "$author_id", "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		},
+		"tags": bson.A{
+			bson.M{"$unwind": "$tags"},
+			bson.M{"$group": bson.M{"_id": "$tags", "count": bson.M{"$sum": 1}}},
+			bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+		},
+		"months": bson.A{
+			bson.M{"$match": bson.M{"created_at": bson.M{"$type": "date"}}},
+			bson.M{"$group": bson.M{
+				"_id":   bson.M{"$dateToString": bson.M{"format": "%Y-%m", "date": "$created_at"}},
+				"count": bson.M{"$sum": 1},
+			}},
+			bson.M{"$sort": bson.M{"_id": 1}},
+		},
+	}}},
+}
+
+func (s *server) GetBlogStats(ctx context.Context, req *pb.GetBlogStatsRequest) (*pb.GetBlogStatsResponse, error) {
+	t, err := s.tenants.fromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cur, err := t.collection.Aggregate(ctx, statsPipeline)
+	if err != nil {
+		return nil, internalError(ctx, "Cannot aggregate statistics in MongoDB: %v", err)
+	}
+	defer cur.Close(ctx)
+
+	// $facet always returns exactly one document
+	result := &statsResult{}
+	if cur.Next(ctx) {
+		if err := cur.Decode(result); err != nil {
+			return nil, internalError(ctx, "Error decoding statistics from MongoDB: %v", err)
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return nil, internalError(ctx, "Unknown internal error: %v", err)
+	}
+
+	res := &pb.GetBlogStatsResponse{
+		PostsPerAuthor: statsToPb(result.Authors),
+		PostsPerTag:    statsToPb(result.Tags),
+		PostsPerMonth:  statsToPb(result.Months),
+	}
+	if len(result.Totals) > 0 {
+		res.TotalBlogs = result.Totals[0].Count
+		res.AverageContentLength = result.Totals[0].AverageLength
+	}
+	return res, nil
+}
+
+func statsToPb(counts []statsCount) []*pb.StatsCount {
+	res := make([]*pb.StatsCount, 0, len(counts))
+	for _, c := range counts {
+		res = append(res, &pb.StatsCount{Key: c.Key, Count: c.Count})
+	}
+	return res
+}
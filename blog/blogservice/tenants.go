@@ -0,0 +1,257 @@
+package blogservice
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tenantMetadataKey is the request metadata key selecting the tenant.
+// Requests without it use the default tenant.
+const tenantMetadataKey = "tenant"
+
+var tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// tenant holds everything that is scoped to a single tenant.
+type tenant struct {
+	name       string
+	collection *mongo.Collection
+	cache      *blogCache
+	related    *relatedIndex
+}
+
+type tenantItem struct {
+	Name      string    `bson:"_id"`
+	Database  string    `bson:"database"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+// tenantStore keeps track of the provisioned tenants. The default tenant
+// lives in the base database, every other tenant in its own database
+// named <base>_<tenant>. The registry of tenants is kept in the base database.
+type tenantStore struct {
+	client   *mongo.Client
+	database string
+	registry *mongo.Collection
+
+	mu      sync.RWMutex
+	tenants map[string]*tenant
+}
+
+func newTenantStore(client *mongo.Client, database string) *tenantStore {
+	return &tenantStore{
+		client:   client,
+		database: database,
+		registry: client.Database(database).Collection("tenants"),
+		tenants:  make(map[string]*tenant),
+	}
+}
+
+// load migrates and registers the default tenant and all provisioned tenants.
+func (ts *tenantStore) load(ctx context.Context) error {
+	if err := ts.open(ctx, "", ts.database); err != nil {
+		return err
+	}
+
+	cur, err := ts.registry.Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("cannot read tenants: %v", err)
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		item := &tenantItem{}
+		if err := cur.Decode(item); err != nil {
+			return fmt.Errorf("cannot decode tenant: %v", err)
+		}
+		if err := ts.open(ctx, item.Name, item.Database); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func (ts *tenantStore) open(ctx context.Context, name string, database string) error {
+	coll := ts.client.Database(database).Collection("blog")
+	if err := migrate(ctx, coll); err != nil {
+		return fmt.Errorf("cannot migrate tenant %q: %v", name, err)
+	}
+	related := newRelatedIndex()
+	if err := related.load(ctx, coll); err != nil {
+		return fmt.Errorf("cannot index blogs of tenant %q: %v", name, err)
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.tenants[name] = &tenant{
+		name:       name,
+		collection: coll,
+		cache:      newBlogCache(*cacheSize, *cacheTTL),
+		related:    related,
+	}
+	return nil
+}
+
+// databases returns the databases of all tenants.
+func (ts *tenantStore) databases() []*mongo.Database {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	dbs := make([]*mongo.Database, 0, len(ts.tenants))
+	for _, t := range ts.tenants {
+		dbs = append(dbs, t.collection.Database())
+	}
+	return dbs
+}
+
+// all returns all tenants.
+func (ts *tenantStore) all() []*tenant {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	tenants := make([]*tenant, 0, len(ts.tenants))
+	for _, t := range ts.tenants {
+		tenants = append(tenants, t)
+	}
+	return tenants
+}
+
+// fromContext returns the tenant selected by the request metadata.
+func (ts *tenantStore) fromContext(ctx context.Context) (*tenant, error) {
+	name := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(tenantMetadataKey); len(values) > 0 {
+			name = values[0]
+		}
+	}
+
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	t, ok := ts.tenants[name]
+	if !ok {
+		return nil, status.Error(
+			codes.NotFound,
+			fmt.Sprintf("Unknown tenant: %q", name))
+	}
+	return t, nil
+}
+
+func (ts *tenantStore) create(ctx context.Context, name string) (*tenantItem, error) {
+	if !tenantNamePattern.MatchString(name) {
+		return nil, status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Invalid tenant name: %q", name))
+	}
+
+	item := &tenantItem{
+		Name:      name,
+		Database:  ts.database + "_" + name,
+		CreatedAt: time.Now().UTC(),
+	}
+	if _, err := ts.registry.InsertOne(ctx, item); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, status.Error(
+				codes.AlreadyExists,
+				fmt.Sprintf("Tenant already exists: %q", name))
+		}
+		return nil, internalError(ctx, "Cannot register tenant in MongoDB: %v", err)
+	}
+	if err := ts.open(ctx, item.Name, item.Database); err != nil {
+		// Unregister the tenant, so that it can be created again, also
+		// when the call ran out of time
+		cleanupCtx := context.WithoutCancel(ctx)
+		if _, delErr := ts.registry.DeleteOne(cleanupCtx, bson.M{"_id": item.Name}); delErr != nil {
+			slog.Error("Cannot unregister tenant", "tenant", item.Name, "error", delErr)
+		}
+		return nil, internalError(ctx, "Cannot open tenant: %v", err)
+	}
+	return item, nil
+}
+
+// delete unregisters the tenant and drops its database with all its blogs.
+func (ts *tenantStore) delete(ctx context.Context, name string) error {
+	if name == "" {
+		return status.Errorf(codes.InvalidArgument, "The default tenant cannot be deleted")
+	}
+
+	item := &tenantItem{}
+	if err := ts.registry.FindOneAndDelete(ctx, bson.M{"_id": name}).Decode(item); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return status.Error(
+				codes.NotFound,
+				fmt.Sprintf("Unknown tenant: %q", name))
+		}
+		return internalError(ctx, "Cannot unregister tenant in MongoDB: %v", err)
+	}
+
+	ts.mu.Lock()
+	delete(ts.tenants, name)
+	ts.mu.Unlock()
+
+	if err := ts.client.Database(item.Database).Drop(ctx); err != nil {
+		return internalError(ctx, "Cannot drop tenant database in MongoDB: %v", err)
+	}
+	return nil
+}
+
+func (ts *tenantStore) list(ctx context.Context) ([]*tenantItem, error) {
+	cur, err := ts.registry.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, internalError(ctx, "Cannot read tenants from MongoDB: %v", err)
+	}
+	items := []*tenantItem{}
+	if err := cur.All(ctx, &items); err != nil {
+		return nil, internalError(ctx, "Error decoding tenants from MongoDB: %v", err)
+	}
+	return items, nil
+}
+
+// adminServer implements BlogAdminService, used to provision tenants.
+type adminServer struct {
+	*Service
+}
+
+func (s *adminServer) CreateTenant(ctx context.Context, req *pb.CreateTenantRequest) (*pb.CreateTenantResponse, error) {
+	item, err := s.tenants.create(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return &pb.CreateTenantResponse{Tenant: tenantToPb(item)}, nil
+}
+
+func (s *adminServer) DeleteTenant(ctx context.Context, req *pb.DeleteTenantRequest) (*pb.DeleteTenantResponse, error) {
+	if err := s.tenants.delete(ctx, req.GetName()); err != nil {
+		return nil, err
+	}
+	return &pb.DeleteTenantResponse{Name: req.GetName()}, nil
+}
+
+func (s *adminServer) ListTenants(ctx context.Context, req *pb.ListTenantsRequest) (*pb.ListTenantsResponse, error) {
+	items, err := s.tenants.list(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := &pb.ListTenantsResponse{}
+	for _, item := range items {
+		res.Tenants = append(res.Tenants, tenantToPb(item))
+	}
+	return res, nil
+}
+
+func tenantToPb(item *tenantItem) *pb.Tenant {
+	return &pb.Tenant{
+		Name:      item.Name,
+		Database:  item.Database,
+		CreatedAt: unixTime(item.CreatedAt),
+	}
+}
@@ -0,0 +1,65 @@
+package blogservice
+
+import (
+	"context"
+	"flag"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+var rpcTimeout = flag.Duration("rpc-timeout", 10*time.Second, "Default deadline of calls without a specific timeout")
+
+// rpcTimeouts overrides the default deadline for calls that are expected
+// to take longer. Shorter deadlines set by the client always win.
+var rpcTimeouts = map[string]time.Duration{
+	"/blog.BlogService/ListBlog":          5 * time.Minute,
+	"/blog.BlogService/GetBlogStats":      time.Minute,
+	"/blog.BlogAdminService/CreateTenant": time.Minute,
+	"/blog.BlogAdminService/DeleteTenant": time.Minute,
+}
+
+// timeoutFor returns the deadline of a method, or false for the methods
+// of other services sharing the server.
+func timeoutFor(method string) (time.Duration, bool) {
+	if !strings.HasPrefix(method, "/blog.") {
+		return 0, false
+	}
+	if timeout, ok := rpcTimeouts[method]; ok {
+		return timeout, true
+	}
+	return *rpcTimeout, true
+}
+
+// UnaryTimeoutInterceptor sets the deadline of unary blog calls.
+func UnaryTimeoutInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	timeout, ok := timeoutFor(info.FullMethod)
+	if !ok {
+		return handler(ctx, req)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return handler(ctx, req)
+}
+
+// StreamTimeoutInterceptor sets the deadline of streaming blog calls.
+func StreamTimeoutInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	timeout, ok := timeoutFor(info.FullMethod)
+	if !ok {
+		return handler(srv, ss)
+	}
+	ctx, cancel := context.WithTimeout(ss.Context(), timeout)
+	defer cancel()
+	return handler(srv, &timeoutStream{ServerStream: ss, ctx: ctx})
+}
+
+// timeoutStream replaces the context of a server stream.
+type timeoutStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *timeoutStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,43 @@
+package blogservice
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/andreasatle/Udemy/grpc-go-course/blog/blogservice")
+
+// mongoSpans holds the spans of the running MongoDB commands, by request id.
+var mongoSpans sync.Map
+
+// startMongoSpan starts a span for a MongoDB command, as a child of the
+// span of the call running it.
+func startMongoSpan(ctx context.Context, e *event.CommandStartedEvent) {
+	_, span := tracer.Start(ctx, "mongo."+e.CommandName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mongodb"),
+			attribute.String("db.name", e.DatabaseName),
+			attribute.String("db.operation", e.CommandName),
+		))
+	mongoSpans.Store(e.RequestID, span)
+}
+
+func endMongoSpan(requestID int64, err error) {
+	value, ok := mongoSpans.LoadAndDelete(requestID)
+	if !ok {
+		return
+	}
+	span := value.(trace.Span)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
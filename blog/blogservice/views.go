@@ -0,0 +1,55 @@
+package blogservice
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var viewFlushInterval = flag.Duration("view-flush-interval", 10*time.Second, "Time between the writes of the views of cached blogs to MongoDB")
+
+// RunViewFlushes writes the views counted in the read caches to MongoDB
+// every view flush interval, until ctx is canceled. Call FlushViews once
+// more after the server has stopped.
+func (s *Service) RunViewFlushes(ctx context.Context) {
+	ticker := time.NewTicker(*viewFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.FlushViews(ctx)
+		}
+	}
+}
+
+// FlushViews writes the views counted in the read caches of all tenants
+// to MongoDB. Views that cannot be written are kept for the next flush.
+func (s *Service) FlushViews(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, *viewFlushInterval)
+	defer cancel()
+
+	for _, t := range s.tenants.all() {
+		views := t.cache.takeViews()
+		if len(views) == 0 {
+			continue
+		}
+		models := make([]mongo.WriteModel, 0, len(views))
+		for id, n := range views {
+			models = append(models, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": id}).
+				SetUpdate(bson.M{"$inc": bson.M{"views": n}}))
+		}
+		if _, err := t.collection.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			t.cache.restoreViews(views)
+			slog.Error("Cannot write views to MongoDB", "tenant", t.name, "error", err)
+		}
+	}
+}
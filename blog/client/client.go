@@ -2,20 +2,39 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 
 	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"github.com/andreasatle/Udemy/grpc-go-course/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
+var tenant = flag.String("tenant", "", "Tenant of the blogs, empty for the default tenant")
+
 func main() {
 	fmt.Println("Blog Client")
+	flag.Parse()
 
-	opts := grpc.WithInsecure()
+	// Trace the calls when TRACE_EXPORTER is set, see the telemetry package
+	stopTracing, err := telemetry.Setup(telemetry.ConfigFromEnv("blog-client"))
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v\n", err)
+	}
+	defer stopTracing(context.Background())
 
-	cc, err := grpc.Dial("localhost:50051", opts)
+	opts := []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithStatsHandler(otelgrpc.NewClientHandler()),
+		grpc.WithUnaryInterceptor(tenantUnaryInterceptor),
+		grpc.WithStreamInterceptor(tenantStreamInterceptor),
+	}
+
+	cc, err := grpc.Dial("localhost:50051", opts...)
 	if err != nil {
 		log.Fatalf("Could not connect: %v", err)
 	}
@@ -23,10 +42,13 @@ func main() {
 
 	c := pb.NewBlogServiceClient(cc)
 
+	// The blogs are the same on every run, so they are written with force
+	// and marked as duplicates of those of the previous runs
 	blog := &pb.Blog{
 		AuthorId: "Andreas",
 		Title:    "My first blog",
 		Content:  "Content of the first blog",
+		Tags:     []string{"first", "go"},
 	}
 	blogId := createBlog(c, blog)
 	fmt.Println(blogId)
@@ -39,16 +61,43 @@ func main() {
 		AuthorId: "New Author",
 		Title:    "Wind of Change",
 		Content:  "Change, change",
+		Tags:     []string{"music"},
 	}
 	updateBlog(c, newBlog)
+	reactToBlog(c, blogId, "Andreas", "like")
+	reactToBlog(c, blogId, "Anton", "love")
+	removeReaction(c, blogId, "Anton")
 	//deleteBlog(c, blogId)
-	listBlog(c)
+	listBlog(c, pb.ListBlogRequest_POPULARITY)
+	getBlogStats(c)
+	getCacheStats(c)
+	batchWriteBlogs(c, []*pb.BlogWrite{
+		{Op: &pb.BlogWrite_Create{Create: &pb.Blog{AuthorId: "Anton", Title: "Batch", Content: "Written in a batch"}}, Force: true},
+		{Op: &pb.BlogWrite_Update{Update: newBlog}, Force: true},
+	})
+	listRelatedBlogs(c, blogId)
+}
+
+// tenantUnaryInterceptor adds the tenant to the metadata of every unary call.
+func tenantUnaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if *tenant != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "tenant", *tenant)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+// tenantStreamInterceptor adds the tenant to the metadata of every streaming call.
+func tenantStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if *tenant != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "tenant", *tenant)
+	}
+	return streamer(ctx, desc, cc, method, opts...)
 }
 
 func createBlog(c pb.BlogServiceClient, blog *pb.Blog) string {
 	fmt.Printf("Creating a blog: %v\n", blog)
 
-	res, err := c.CreateBlog(context.Background(), &pb.CreateBlogRequest{Blog: blog})
+	res, err := c.CreateBlog(context.Background(), &pb.CreateBlogRequest{Blog: blog, Force: true})
 	if err != nil {
 		log.Fatalf("Unexpected error: %v\n", err)
 	}
@@ -75,7 +124,7 @@ func readBlog(c pb.BlogServiceClient, blogId string) *pb.Blog {
 
 func updateBlog(c pb.BlogServiceClient, blog *pb.Blog) {
 	fmt.Printf("Updating a blog: %v\n", blog)
-	res, err := c.UpdateBlog(context.Background(), &pb.UpdateBlogRequest{Blog: blog})
+	res, err := c.UpdateBlog(context.Background(), &pb.UpdateBlogRequest{Blog: blog, Force: true})
 	if err != nil {
 		fmt.Printf("Error happened while updating: %v\n", err)
 		return
@@ -96,8 +145,34 @@ func deleteBlog(c pb.BlogServiceClient, blogId string) {
 	fmt.Printf("Blog has been deleted: %v\n", res)
 }
 
-func listBlog(c pb.BlogServiceClient) {
-	stream, err := c.ListBlog(context.Background(), &pb.ListBlogRequest{})
+func reactToBlog(c pb.BlogServiceClient, blogId string, userId string, reaction string) {
+	fmt.Printf("Reacting to a blog: %v\n", blogId)
+
+	req := &pb.ReactToBlogRequest{BlogId: blogId, UserId: userId, Reaction: reaction}
+	res, err := c.ReactToBlog(context.Background(), req)
+	if err != nil {
+		fmt.Printf("Error happened while reacting: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Blog has been reacted to: %v\n", res)
+}
+
+func removeReaction(c pb.BlogServiceClient, blogId string, userId string) {
+	fmt.Printf("Removing a reaction from a blog: %v\n", blogId)
+
+	req := &pb.RemoveReactionRequest{BlogId: blogId, UserId: userId}
+	res, err := c.RemoveReaction(context.Background(), req)
+	if err != nil {
+		fmt.Printf("Error happened while removing reaction: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Reaction has been removed: %v\n", res)
+}
+
+func listBlog(c pb.BlogServiceClient, sort pb.ListBlogRequest_Sort) {
+	stream, err := c.ListBlog(context.Background(), &pb.ListBlogRequest{Sort: sort})
 	if err != nil {
 		log.Fatalf("Error calling ListBlog RPC: %v\n", err)
 	}
@@ -113,3 +188,53 @@ func listBlog(c pb.BlogServiceClient) {
 	}
 
 }
+
+func getBlogStats(c pb.BlogServiceClient) {
+	fmt.Println("Getting blog statistics")
+
+	res, err := c.GetBlogStats(context.Background(), &pb.GetBlogStatsRequest{})
+	if err != nil {
+		fmt.Printf("Error happened while getting statistics: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Blog statistics: %v\n", res)
+}
+
+func getCacheStats(c pb.BlogServiceClient) {
+	fmt.Println("Getting cache statistics")
+
+	res, err := c.GetCacheStats(context.Background(), &pb.GetCacheStatsRequest{})
+	if err != nil {
+		fmt.Printf("Error happened while getting cache statistics: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Cache statistics: %v\n", res)
+}
+
+func batchWriteBlogs(c pb.BlogServiceClient, writes []*pb.BlogWrite) {
+	fmt.Printf("Writing a batch of %d blogs\n", len(writes))
+
+	res, err := c.BatchWriteBlogs(context.Background(), &pb.BatchWriteBlogsRequest{Writes: writes})
+	if err != nil {
+		fmt.Printf("Error happened while writing batch: %v\n", err)
+		return
+	}
+
+	fmt.Printf("Batch has been written: %v\n", res)
+}
+
+func listRelatedBlogs(c pb.BlogServiceClient, blogId string) {
+	fmt.Printf("Listing blogs related to: %v\n", blogId)
+
+	res, err := c.ListRelatedBlogs(context.Background(), &pb.ListRelatedBlogsRequest{BlogId: blogId})
+	if err != nil {
+		fmt.Printf("Error happened while listing related blogs: %v\n", err)
+		return
+	}
+
+	for _, related := range res.GetBlogs() {
+		fmt.Printf("%.3f %v\n", related.GetScore(), related.GetBlog())
+	}
+}
@@ -1,14 +1,14 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.25.0-devel
-// 	protoc        v3.13.0
+// 	protoc-gen-go v1.33.0
+// 	protoc        (unknown)
 // source: blog/pb/blog.proto
 
 package pb
 
 import (
 	context "context"
-	proto "github.com/golang/protobuf/proto"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -25,19 +25,173 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
-// This is a compile-time assertion that a sufficiently up-to-date version
-// of the legacy proto package is being used.
-const _ = proto.ProtoPackageIsVersion4
+type ModerationStatus int32
+
+const (
+	ModerationStatus_PUBLISHED      ModerationStatus = 0
+	ModerationStatus_PENDING_REVIEW ModerationStatus = 1 // Hidden from listings until approved
+	ModerationStatus_FLAGGED        ModerationStatus = 2 // Published, but waiting for a moderator to look at it
+	ModerationStatus_REJECTED       ModerationStatus = 3 // Hidden from listings
+)
+
+// Enum value maps for ModerationStatus.
+var (
+	ModerationStatus_name = map[int32]string{
+		0: "PUBLISHED",
+		1: "PENDING_REVIEW",
+		2: "FLAGGED",
+		3: "REJECTED",
+	}
+	ModerationStatus_value = map[string]int32{
+		"PUBLISHED":      0,
+		"PENDING_REVIEW": 1,
+		"FLAGGED":        2,
+		"REJECTED":       3,
+	}
+)
+
+func (x ModerationStatus) Enum() *ModerationStatus {
+	p := new(ModerationStatus)
+	*p = x
+	return p
+}
+
+func (x ModerationStatus) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ModerationStatus) Descriptor() protoreflect.EnumDescriptor {
+	return file_blog_pb_blog_proto_enumTypes[0].Descriptor()
+}
+
+func (ModerationStatus) Type() protoreflect.EnumType {
+	return &file_blog_pb_blog_proto_enumTypes[0]
+}
+
+func (x ModerationStatus) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ModerationStatus.Descriptor instead.
+func (ModerationStatus) EnumDescriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{0}
+}
+
+type ListBlogRequest_Sort int32
+
+const (
+	ListBlogRequest_DEFAULT    ListBlogRequest_Sort = 0
+	ListBlogRequest_POPULARITY ListBlogRequest_Sort = 1 // Most reactions first, then most views
+)
+
+// Enum value maps for ListBlogRequest_Sort.
+var (
+	ListBlogRequest_Sort_name = map[int32]string{
+		0: "DEFAULT",
+		1: "POPULARITY",
+	}
+	ListBlogRequest_Sort_value = map[string]int32{
+		"DEFAULT":    0,
+		"POPULARITY": 1,
+	}
+)
+
+func (x ListBlogRequest_Sort) Enum() *ListBlogRequest_Sort {
+	p := new(ListBlogRequest_Sort)
+	*p = x
+	return p
+}
+
+func (x ListBlogRequest_Sort) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ListBlogRequest_Sort) Descriptor() protoreflect.EnumDescriptor {
+	return file_blog_pb_blog_proto_enumTypes[1].Descriptor()
+}
+
+func (ListBlogRequest_Sort) Type() protoreflect.EnumType {
+	return &file_blog_pb_blog_proto_enumTypes[1]
+}
+
+func (x ListBlogRequest_Sort) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ListBlogRequest_Sort.Descriptor instead.
+func (ListBlogRequest_Sort) EnumDescriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{9, 0}
+}
+
+type ReviewBlogRequest_Decision int32
+
+const (
+	ReviewBlogRequest_UNKNOWN ReviewBlogRequest_Decision = 0
+	ReviewBlogRequest_APPROVE ReviewBlogRequest_Decision = 1
+	ReviewBlogRequest_REJECT  ReviewBlogRequest_Decision = 2
+)
+
+// Enum value maps for ReviewBlogRequest_Decision.
+var (
+	ReviewBlogRequest_Decision_name = map[int32]string{
+		0: "UNKNOWN",
+		1: "APPROVE",
+		2: "REJECT",
+	}
+	ReviewBlogRequest_Decision_value = map[string]int32{
+		"UNKNOWN": 0,
+		"APPROVE": 1,
+		"REJECT":  2,
+	}
+)
+
+func (x ReviewBlogRequest_Decision) Enum() *ReviewBlogRequest_Decision {
+	p := new(ReviewBlogRequest_Decision)
+	*p = x
+	return p
+}
+
+func (x ReviewBlogRequest_Decision) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ReviewBlogRequest_Decision) Descriptor() protoreflect.EnumDescriptor {
+	return file_blog_pb_blog_proto_enumTypes[2].Descriptor()
+}
+
+func (ReviewBlogRequest_Decision) Type() protoreflect.EnumType {
+	return &file_blog_pb_blog_proto_enumTypes[2]
+}
+
+func (x ReviewBlogRequest_Decision) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ReviewBlogRequest_Decision.Descriptor instead.
+func (ReviewBlogRequest_Decision) EnumDescriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{29, 0}
+}
 
 type Blog struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Id       string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	AuthorId string `protobuf:"bytes,2,opt,name=author_id,json=authorId,proto3" json:"author_id,omitempty"`
-	Title    string `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
-	Content  string `protobuf:"bytes,4,opt,name=content,proto3" json:"content,omitempty"`
+	Id                string           `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	AuthorId          string           `protobuf:"bytes,2,opt,name=author_id,json=authorId,proto3" json:"author_id,omitempty"`
+	Title             string           `protobuf:"bytes,3,opt,name=title,proto3" json:"title,omitempty"`
+	Content           string           `protobuf:"bytes,4,opt,name=content,proto3" json:"content,omitempty"`
+	Views             int64            `protobuf:"varint,5,opt,name=views,proto3" json:"views,omitempty"`
+	ReactionCount     int64            `protobuf:"varint,6,opt,name=reaction_count,json=reactionCount,proto3" json:"reaction_count,omitempty"`
+	Reactions         map[string]int64 `protobuf:"bytes,7,rep,name=reactions,proto3" json:"reactions,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"varint,2,opt,name=value,proto3"` // Number of reactions of each kind
+	Tags              []string         `protobuf:"bytes,8,rep,name=tags,proto3" json:"tags,omitempty"`
+	CreatedAt         int64            `protobuf:"varint,9,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`                         // Unix time in seconds
+	UpdatedAt         int64            `protobuf:"varint,10,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`                        // Unix time in seconds
+	Slug              string           `protobuf:"bytes,11,opt,name=slug,proto3" json:"slug,omitempty"`                                                    // Set by the server when the blog is created
+	DuplicateOf       string           `protobuf:"bytes,12,opt,name=duplicate_of,json=duplicateOf,proto3" json:"duplicate_of,omitempty"`                   // Set if written with force despite nearly matching this blog
+	Moderation        ModerationStatus `protobuf:"varint,13,opt,name=moderation,proto3,enum=blog.ModerationStatus" json:"moderation,omitempty"`            // Set by the server
+	ModerationReasons []string         `protobuf:"bytes,14,rep,name=moderation_reasons,json=moderationReasons,proto3" json:"moderation_reasons,omitempty"` // Names of the matching moderation rules
+	ReviewNotes       []string         `protobuf:"bytes,15,rep,name=review_notes,json=reviewNotes,proto3" json:"review_notes,omitempty"`
 }
 
 func (x *Blog) Reset() {
@@ -100,12 +254,90 @@ func (x *Blog) GetContent() string {
 	return ""
 }
 
+func (x *Blog) GetViews() int64 {
+	if x != nil {
+		return x.Views
+	}
+	return 0
+}
+
+func (x *Blog) GetReactionCount() int64 {
+	if x != nil {
+		return x.ReactionCount
+	}
+	return 0
+}
+
+func (x *Blog) GetReactions() map[string]int64 {
+	if x != nil {
+		return x.Reactions
+	}
+	return nil
+}
+
+func (x *Blog) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Blog) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+func (x *Blog) GetUpdatedAt() int64 {
+	if x != nil {
+		return x.UpdatedAt
+	}
+	return 0
+}
+
+func (x *Blog) GetSlug() string {
+	if x != nil {
+		return x.Slug
+	}
+	return ""
+}
+
+func (x *Blog) GetDuplicateOf() string {
+	if x != nil {
+		return x.DuplicateOf
+	}
+	return ""
+}
+
+func (x *Blog) GetModeration() ModerationStatus {
+	if x != nil {
+		return x.Moderation
+	}
+	return ModerationStatus_PUBLISHED
+}
+
+func (x *Blog) GetModerationReasons() []string {
+	if x != nil {
+		return x.ModerationReasons
+	}
+	return nil
+}
+
+func (x *Blog) GetReviewNotes() []string {
+	if x != nil {
+		return x.ReviewNotes
+	}
+	return nil
+}
+
 type CreateBlogRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Blog *Blog `protobuf:"bytes,1,opt,name=blog,proto3" json:"blog,omitempty"`
+	Blog  *Blog `protobuf:"bytes,1,opt,name=blog,proto3" json:"blog,omitempty"`
+	Force bool  `protobuf:"varint,2,opt,name=force,proto3" json:"force,omitempty"` // Create the blog even if its content nearly matches another one
 }
 
 func (x *CreateBlogRequest) Reset() {
@@ -147,6 +379,13 @@ func (x *CreateBlogRequest) GetBlog() *Blog {
 	return nil
 }
 
+func (x *CreateBlogRequest) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
 type CreateBlogResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -293,7 +532,8 @@ type UpdateBlogRequest struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Blog *Blog `protobuf:"bytes,1,opt,name=blog,proto3" json:"blog,omitempty"`
+	Blog  *Blog `protobuf:"bytes,1,opt,name=blog,proto3" json:"blog,omitempty"`
+	Force bool  `protobuf:"varint,2,opt,name=force,proto3" json:"force,omitempty"` // Update the blog even if its content nearly matches another one
 }
 
 func (x *UpdateBlogRequest) Reset() {
@@ -335,6 +575,13 @@ func (x *UpdateBlogRequest) GetBlog() *Blog {
 	return nil
 }
 
+func (x *UpdateBlogRequest) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
 type UpdateBlogResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -480,6 +727,8 @@ type ListBlogRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
+
+	Sort ListBlogRequest_Sort `protobuf:"varint,1,opt,name=sort,proto3,enum=blog.ListBlogRequest_Sort" json:"sort,omitempty"`
 }
 
 func (x *ListBlogRequest) Reset() {
@@ -514,6 +763,13 @@ func (*ListBlogRequest) Descriptor() ([]byte, []int) {
 	return file_blog_pb_blog_proto_rawDescGZIP(), []int{9}
 }
 
+func (x *ListBlogRequest) GetSort() ListBlogRequest_Sort {
+	if x != nil {
+		return x.Sort
+	}
+	return ListBlogRequest_DEFAULT
+}
+
 type ListBlogResponse struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -561,178 +817,2211 @@ func (x *ListBlogResponse) GetBlog() *Blog {
 	return nil
 }
 
-var File_blog_pb_blog_proto protoreflect.FileDescriptor
+type ReactToBlogRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
 
-var file_blog_pb_blog_proto_rawDesc = []byte{
-	0x0a, 0x12, 0x62, 0x6c, 0x6f, 0x67, 0x2f, 0x70, 0x62, 0x2f, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x70,
-	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x22, 0x63, 0x0a, 0x04, 0x42, 0x6c,
-	0x6f, 0x67, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02,
-	0x69, 0x64, 0x12, 0x1b, 0x0a, 0x09, 0x61, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x5f, 0x69, 0x64, 0x18,
-	0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x61, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x49, 0x64, 0x12,
-	0x14, 0x0a, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
-	0x74, 0x69, 0x74, 0x6c, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74,
-	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x22,
-	0x33, 0x0a, 0x11, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71,
-	0x75, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20, 0x01,
-	0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04,
-	0x62, 0x6c, 0x6f, 0x67, 0x22, 0x34, 0x0a, 0x12, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x42, 0x6c,
-	0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c,
-	0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e,
-	0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x22, 0x2a, 0x0a, 0x0f, 0x52, 0x65,
-	0x61, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a,
-	0x07, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
-	0x62, 0x6c, 0x6f, 0x67, 0x49, 0x64, 0x22, 0x32, 0x0a, 0x10, 0x52, 0x65, 0x61, 0x64, 0x42, 0x6c,
-	0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c,
-	0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e,
-	0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x22, 0x33, 0x0a, 0x11, 0x55, 0x70,
-	0x64, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
-	0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e,
-	0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x22,
-	0x34, 0x0a, 0x12, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52,
-	0x04, 0x62, 0x6c, 0x6f, 0x67, 0x22, 0x2c, 0x0a, 0x11, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x42,
-	0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x62, 0x6c,
-	0x6f, 0x67, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62, 0x6c, 0x6f,
-	0x67, 0x49, 0x64, 0x22, 0x2d, 0x0a, 0x12, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x42, 0x6c, 0x6f,
-	0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x62, 0x6c, 0x6f,
-	0x67, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62, 0x6c, 0x6f, 0x67,
-	0x49, 0x64, 0x22, 0x11, 0x0a, 0x0f, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x32, 0x0a, 0x10, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x6c, 0x6f,
-	0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f,
-	0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42,
-	0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x32, 0xc8, 0x02, 0x0a, 0x0b, 0x42, 0x6c,
-	0x6f, 0x67, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x3f, 0x0a, 0x0a, 0x43, 0x72, 0x65,
-	0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x12, 0x17, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x43,
-	0x72, 0x65, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
-	0x1a, 0x18, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x42, 0x6c,
-	0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x39, 0x0a, 0x08, 0x52, 0x65,
-	0x61, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x12, 0x15, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x52, 0x65,
-	0x61, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e,
-	0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x52, 0x65, 0x61, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73,
-	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3f, 0x0a, 0x0a, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x42,
-	0x6c, 0x6f, 0x67, 0x12, 0x17, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74,
-	0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e, 0x62,
-	0x6c, 0x6f, 0x67, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65,
-	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3f, 0x0a, 0x0a, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65,
-	0x42, 0x6c, 0x6f, 0x67, 0x12, 0x17, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x44, 0x65, 0x6c, 0x65,
-	0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e,
-	0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52,
-	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3b, 0x0a, 0x08, 0x4c, 0x69, 0x73, 0x74, 0x42,
-	0x6c, 0x6f, 0x67, 0x12, 0x15, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x42,
-	0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x62, 0x6c, 0x6f,
-	0x67, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e,
-	0x73, 0x65, 0x30, 0x01, 0x42, 0x09, 0x5a, 0x07, 0x62, 0x6c, 0x6f, 0x67, 0x2f, 0x70, 0x62, 0x62,
-	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	BlogId   string `protobuf:"bytes,1,opt,name=blog_id,json=blogId,proto3" json:"blog_id,omitempty"`
+	UserId   string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Reaction string `protobuf:"bytes,3,opt,name=reaction,proto3" json:"reaction,omitempty"` // Defaults to "like"
 }
 
-var (
-	file_blog_pb_blog_proto_rawDescOnce sync.Once
-	file_blog_pb_blog_proto_rawDescData = file_blog_pb_blog_proto_rawDesc
-)
+func (x *ReactToBlogRequest) Reset() {
+	*x = ReactToBlogRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
 
-func file_blog_pb_blog_proto_rawDescGZIP() []byte {
-	file_blog_pb_blog_proto_rawDescOnce.Do(func() {
-		file_blog_pb_blog_proto_rawDescData = protoimpl.X.CompressGZIP(file_blog_pb_blog_proto_rawDescData)
-	})
-	return file_blog_pb_blog_proto_rawDescData
+func (x *ReactToBlogRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-var file_blog_pb_blog_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
-var file_blog_pb_blog_proto_goTypes = []interface{}{
-	(*Blog)(nil),               // 0: blog.Blog
-	(*CreateBlogRequest)(nil),  // 1: blog.CreateBlogRequest
-	(*CreateBlogResponse)(nil), // 2: blog.CreateBlogResponse
-	(*ReadBlogRequest)(nil),    // 3: blog.ReadBlogRequest
-	(*ReadBlogResponse)(nil),   // 4: blog.ReadBlogResponse
-	(*UpdateBlogRequest)(nil),  // 5: blog.UpdateBlogRequest
-	(*UpdateBlogResponse)(nil), // 6: blog.UpdateBlogResponse
-	(*DeleteBlogRequest)(nil),  // 7: blog.DeleteBlogRequest
-	(*DeleteBlogResponse)(nil), // 8: blog.DeleteBlogResponse
-	(*ListBlogRequest)(nil),    // 9: blog.ListBlogRequest
-	(*ListBlogResponse)(nil),   // 10: blog.ListBlogResponse
+func (*ReactToBlogRequest) ProtoMessage() {}
+
+func (x *ReactToBlogRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
 }
-var file_blog_pb_blog_proto_depIdxs = []int32{
-	0,  // 0: blog.CreateBlogRequest.blog:type_name -> blog.Blog
-	0,  // 1: blog.CreateBlogResponse.blog:type_name -> blog.Blog
-	0,  // 2: blog.ReadBlogResponse.blog:type_name -> blog.Blog
-	0,  // 3: blog.UpdateBlogRequest.blog:type_name -> blog.Blog
-	0,  // 4: blog.UpdateBlogResponse.blog:type_name -> blog.Blog
-	0,  // 5: blog.ListBlogResponse.blog:type_name -> blog.Blog
-	1,  // 6: blog.BlogService.CreateBlog:input_type -> blog.CreateBlogRequest
-	3,  // 7: blog.BlogService.ReadBlog:input_type -> blog.ReadBlogRequest
-	5,  // 8: blog.BlogService.UpdateBlog:input_type -> blog.UpdateBlogRequest
-	7,  // 9: blog.BlogService.DeleteBlog:input_type -> blog.DeleteBlogRequest
-	9,  // 10: blog.BlogService.ListBlog:input_type -> blog.ListBlogRequest
-	2,  // 11: blog.BlogService.CreateBlog:output_type -> blog.CreateBlogResponse
-	4,  // 12: blog.BlogService.ReadBlog:output_type -> blog.ReadBlogResponse
-	6,  // 13: blog.BlogService.UpdateBlog:output_type -> blog.UpdateBlogResponse
-	8,  // 14: blog.BlogService.DeleteBlog:output_type -> blog.DeleteBlogResponse
-	10, // 15: blog.BlogService.ListBlog:output_type -> blog.ListBlogResponse
-	11, // [11:16] is the sub-list for method output_type
-	6,  // [6:11] is the sub-list for method input_type
-	6,  // [6:6] is the sub-list for extension type_name
-	6,  // [6:6] is the sub-list for extension extendee
-	0,  // [0:6] is the sub-list for field type_name
+
+// Deprecated: Use ReactToBlogRequest.ProtoReflect.Descriptor instead.
+func (*ReactToBlogRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{11}
 }
 
-func init() { file_blog_pb_blog_proto_init() }
-func file_blog_pb_blog_proto_init() {
-	if File_blog_pb_blog_proto != nil {
-		return
+func (x *ReactToBlogRequest) GetBlogId() string {
+	if x != nil {
+		return x.BlogId
 	}
-	if !protoimpl.UnsafeEnabled {
-		file_blog_pb_blog_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*Blog); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_blog_pb_blog_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*CreateBlogRequest); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_blog_pb_blog_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*CreateBlogResponse); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
-		}
-		file_blog_pb_blog_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ReadBlogRequest); i {
-			case 0:
-				return &v.state
-			case 1:
-				return &v.sizeCache
-			case 2:
-				return &v.unknownFields
-			default:
-				return nil
-			}
+	return ""
+}
+
+func (x *ReactToBlogRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ReactToBlogRequest) GetReaction() string {
+	if x != nil {
+		return x.Reaction
+	}
+	return ""
+}
+
+type ReactToBlogResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Blog *Blog `protobuf:"bytes,1,opt,name=blog,proto3" json:"blog,omitempty"`
+}
+
+func (x *ReactToBlogResponse) Reset() {
+	*x = ReactToBlogResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReactToBlogResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReactToBlogResponse) ProtoMessage() {}
+
+func (x *ReactToBlogResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
 		}
-		file_blog_pb_blog_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ReadBlogResponse); i {
-			case 0:
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReactToBlogResponse.ProtoReflect.Descriptor instead.
+func (*ReactToBlogResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *ReactToBlogResponse) GetBlog() *Blog {
+	if x != nil {
+		return x.Blog
+	}
+	return nil
+}
+
+type RemoveReactionRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BlogId string `protobuf:"bytes,1,opt,name=blog_id,json=blogId,proto3" json:"blog_id,omitempty"`
+	UserId string `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+}
+
+func (x *RemoveReactionRequest) Reset() {
+	*x = RemoveReactionRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RemoveReactionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveReactionRequest) ProtoMessage() {}
+
+func (x *RemoveReactionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveReactionRequest.ProtoReflect.Descriptor instead.
+func (*RemoveReactionRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *RemoveReactionRequest) GetBlogId() string {
+	if x != nil {
+		return x.BlogId
+	}
+	return ""
+}
+
+func (x *RemoveReactionRequest) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+type RemoveReactionResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Blog *Blog `protobuf:"bytes,1,opt,name=blog,proto3" json:"blog,omitempty"`
+}
+
+func (x *RemoveReactionResponse) Reset() {
+	*x = RemoveReactionResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RemoveReactionResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveReactionResponse) ProtoMessage() {}
+
+func (x *RemoveReactionResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveReactionResponse.ProtoReflect.Descriptor instead.
+func (*RemoveReactionResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *RemoveReactionResponse) GetBlog() *Blog {
+	if x != nil {
+		return x.Blog
+	}
+	return nil
+}
+
+type GetBlogStatsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *GetBlogStatsRequest) Reset() {
+	*x = GetBlogStatsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetBlogStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBlogStatsRequest) ProtoMessage() {}
+
+func (x *GetBlogStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBlogStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetBlogStatsRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{15}
+}
+
+type StatsCount struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Key   string `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	Count int64  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+}
+
+func (x *StatsCount) Reset() {
+	*x = StatsCount{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *StatsCount) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsCount) ProtoMessage() {}
+
+func (x *StatsCount) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsCount.ProtoReflect.Descriptor instead.
+func (*StatsCount) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *StatsCount) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *StatsCount) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type GetBlogStatsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TotalBlogs           int64         `protobuf:"varint,1,opt,name=total_blogs,json=totalBlogs,proto3" json:"total_blogs,omitempty"`
+	AverageContentLength float64       `protobuf:"fixed64,2,opt,name=average_content_length,json=averageContentLength,proto3" json:"average_content_length,omitempty"` // In characters
+	PostsPerAuthor       []*StatsCount `protobuf:"bytes,3,rep,name=posts_per_author,json=postsPerAuthor,proto3" json:"posts_per_author,omitempty"`
+	PostsPerTag          []*StatsCount `protobuf:"bytes,4,rep,name=posts_per_tag,json=postsPerTag,proto3" json:"posts_per_tag,omitempty"`
+	PostsPerMonth        []*StatsCount `protobuf:"bytes,5,rep,name=posts_per_month,json=postsPerMonth,proto3" json:"posts_per_month,omitempty"` // Key is formatted as YYYY-MM
+}
+
+func (x *GetBlogStatsResponse) Reset() {
+	*x = GetBlogStatsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetBlogStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetBlogStatsResponse) ProtoMessage() {}
+
+func (x *GetBlogStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetBlogStatsResponse.ProtoReflect.Descriptor instead.
+func (*GetBlogStatsResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *GetBlogStatsResponse) GetTotalBlogs() int64 {
+	if x != nil {
+		return x.TotalBlogs
+	}
+	return 0
+}
+
+func (x *GetBlogStatsResponse) GetAverageContentLength() float64 {
+	if x != nil {
+		return x.AverageContentLength
+	}
+	return 0
+}
+
+func (x *GetBlogStatsResponse) GetPostsPerAuthor() []*StatsCount {
+	if x != nil {
+		return x.PostsPerAuthor
+	}
+	return nil
+}
+
+func (x *GetBlogStatsResponse) GetPostsPerTag() []*StatsCount {
+	if x != nil {
+		return x.PostsPerTag
+	}
+	return nil
+}
+
+func (x *GetBlogStatsResponse) GetPostsPerMonth() []*StatsCount {
+	if x != nil {
+		return x.PostsPerMonth
+	}
+	return nil
+}
+
+type GetCacheStatsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *GetCacheStatsRequest) Reset() {
+	*x = GetCacheStatsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetCacheStatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCacheStatsRequest) ProtoMessage() {}
+
+func (x *GetCacheStatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCacheStatsRequest.ProtoReflect.Descriptor instead.
+func (*GetCacheStatsRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{18}
+}
+
+type GetCacheStatsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Hits     int64 `protobuf:"varint,1,opt,name=hits,proto3" json:"hits,omitempty"`
+	Misses   int64 `protobuf:"varint,2,opt,name=misses,proto3" json:"misses,omitempty"`
+	Entries  int64 `protobuf:"varint,3,opt,name=entries,proto3" json:"entries,omitempty"`
+	Capacity int64 `protobuf:"varint,4,opt,name=capacity,proto3" json:"capacity,omitempty"` // 0 if the cache is disabled
+}
+
+func (x *GetCacheStatsResponse) Reset() {
+	*x = GetCacheStatsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[19]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *GetCacheStatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCacheStatsResponse) ProtoMessage() {}
+
+func (x *GetCacheStatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[19]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCacheStatsResponse.ProtoReflect.Descriptor instead.
+func (*GetCacheStatsResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *GetCacheStatsResponse) GetHits() int64 {
+	if x != nil {
+		return x.Hits
+	}
+	return 0
+}
+
+func (x *GetCacheStatsResponse) GetMisses() int64 {
+	if x != nil {
+		return x.Misses
+	}
+	return 0
+}
+
+func (x *GetCacheStatsResponse) GetEntries() int64 {
+	if x != nil {
+		return x.Entries
+	}
+	return 0
+}
+
+func (x *GetCacheStatsResponse) GetCapacity() int64 {
+	if x != nil {
+		return x.Capacity
+	}
+	return 0
+}
+
+type BlogWrite struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Op:
+	//	*BlogWrite_Create
+	//	*BlogWrite_Update
+	//	*BlogWrite_DeleteBlogId
+	Op    isBlogWrite_Op `protobuf_oneof:"op"`
+	Force bool           `protobuf:"varint,4,opt,name=force,proto3" json:"force,omitempty"` // Skip the duplicate check of a create or update
+}
+
+func (x *BlogWrite) Reset() {
+	*x = BlogWrite{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[20]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BlogWrite) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlogWrite) ProtoMessage() {}
+
+func (x *BlogWrite) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[20]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlogWrite.ProtoReflect.Descriptor instead.
+func (*BlogWrite) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{20}
+}
+
+func (m *BlogWrite) GetOp() isBlogWrite_Op {
+	if m != nil {
+		return m.Op
+	}
+	return nil
+}
+
+func (x *BlogWrite) GetCreate() *Blog {
+	if x, ok := x.GetOp().(*BlogWrite_Create); ok {
+		return x.Create
+	}
+	return nil
+}
+
+func (x *BlogWrite) GetUpdate() *Blog {
+	if x, ok := x.GetOp().(*BlogWrite_Update); ok {
+		return x.Update
+	}
+	return nil
+}
+
+func (x *BlogWrite) GetDeleteBlogId() string {
+	if x, ok := x.GetOp().(*BlogWrite_DeleteBlogId); ok {
+		return x.DeleteBlogId
+	}
+	return ""
+}
+
+func (x *BlogWrite) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
+type isBlogWrite_Op interface {
+	isBlogWrite_Op()
+}
+
+type BlogWrite_Create struct {
+	Create *Blog `protobuf:"bytes,1,opt,name=create,proto3,oneof"`
+}
+
+type BlogWrite_Update struct {
+	Update *Blog `protobuf:"bytes,2,opt,name=update,proto3,oneof"`
+}
+
+type BlogWrite_DeleteBlogId struct {
+	DeleteBlogId string `protobuf:"bytes,3,opt,name=delete_blog_id,json=deleteBlogId,proto3,oneof"`
+}
+
+func (*BlogWrite_Create) isBlogWrite_Op() {}
+
+func (*BlogWrite_Update) isBlogWrite_Op() {}
+
+func (*BlogWrite_DeleteBlogId) isBlogWrite_Op() {}
+
+type BatchWriteBlogsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Writes []*BlogWrite `protobuf:"bytes,1,rep,name=writes,proto3" json:"writes,omitempty"`
+}
+
+func (x *BatchWriteBlogsRequest) Reset() {
+	*x = BatchWriteBlogsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[21]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchWriteBlogsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchWriteBlogsRequest) ProtoMessage() {}
+
+func (x *BatchWriteBlogsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[21]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchWriteBlogsRequest.ProtoReflect.Descriptor instead.
+func (*BatchWriteBlogsRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *BatchWriteBlogsRequest) GetWrites() []*BlogWrite {
+	if x != nil {
+		return x.Writes
+	}
+	return nil
+}
+
+type BlogWriteResult struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Blog          *Blog  `protobuf:"bytes,1,opt,name=blog,proto3" json:"blog,omitempty"` // The created or updated blog
+	DeletedBlogId string `protobuf:"bytes,2,opt,name=deleted_blog_id,json=deletedBlogId,proto3" json:"deleted_blog_id,omitempty"`
+}
+
+func (x *BlogWriteResult) Reset() {
+	*x = BlogWriteResult{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[22]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BlogWriteResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlogWriteResult) ProtoMessage() {}
+
+func (x *BlogWriteResult) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[22]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlogWriteResult.ProtoReflect.Descriptor instead.
+func (*BlogWriteResult) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *BlogWriteResult) GetBlog() *Blog {
+	if x != nil {
+		return x.Blog
+	}
+	return nil
+}
+
+func (x *BlogWriteResult) GetDeletedBlogId() string {
+	if x != nil {
+		return x.DeletedBlogId
+	}
+	return ""
+}
+
+type BatchWriteBlogsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Results []*BlogWriteResult `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"` // In the order of the writes
+}
+
+func (x *BatchWriteBlogsResponse) Reset() {
+	*x = BatchWriteBlogsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[23]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *BatchWriteBlogsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BatchWriteBlogsResponse) ProtoMessage() {}
+
+func (x *BatchWriteBlogsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[23]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BatchWriteBlogsResponse.ProtoReflect.Descriptor instead.
+func (*BatchWriteBlogsResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *BatchWriteBlogsResponse) GetResults() []*BlogWriteResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type ListRelatedBlogsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BlogId string `protobuf:"bytes,1,opt,name=blog_id,json=blogId,proto3" json:"blog_id,omitempty"`
+	Limit  int32  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"` // Defaults to 5, at most 50
+}
+
+func (x *ListRelatedBlogsRequest) Reset() {
+	*x = ListRelatedBlogsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[24]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListRelatedBlogsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRelatedBlogsRequest) ProtoMessage() {}
+
+func (x *ListRelatedBlogsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[24]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRelatedBlogsRequest.ProtoReflect.Descriptor instead.
+func (*ListRelatedBlogsRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ListRelatedBlogsRequest) GetBlogId() string {
+	if x != nil {
+		return x.BlogId
+	}
+	return ""
+}
+
+func (x *ListRelatedBlogsRequest) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type RelatedBlog struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Blog  *Blog   `protobuf:"bytes,1,opt,name=blog,proto3" json:"blog,omitempty"`
+	Score float64 `protobuf:"fixed64,2,opt,name=score,proto3" json:"score,omitempty"` // Cosine similarity, between 0 and 1
+}
+
+func (x *RelatedBlog) Reset() {
+	*x = RelatedBlog{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[25]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RelatedBlog) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RelatedBlog) ProtoMessage() {}
+
+func (x *RelatedBlog) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[25]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RelatedBlog.ProtoReflect.Descriptor instead.
+func (*RelatedBlog) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *RelatedBlog) GetBlog() *Blog {
+	if x != nil {
+		return x.Blog
+	}
+	return nil
+}
+
+func (x *RelatedBlog) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+type ListRelatedBlogsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Blogs []*RelatedBlog `protobuf:"bytes,1,rep,name=blogs,proto3" json:"blogs,omitempty"` // Most similar first
+}
+
+func (x *ListRelatedBlogsResponse) Reset() {
+	*x = ListRelatedBlogsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[26]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListRelatedBlogsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListRelatedBlogsResponse) ProtoMessage() {}
+
+func (x *ListRelatedBlogsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[26]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListRelatedBlogsResponse.ProtoReflect.Descriptor instead.
+func (*ListRelatedBlogsResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *ListRelatedBlogsResponse) GetBlogs() []*RelatedBlog {
+	if x != nil {
+		return x.Blogs
+	}
+	return nil
+}
+
+type ListModerationQueueRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListModerationQueueRequest) Reset() {
+	*x = ListModerationQueueRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[27]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListModerationQueueRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListModerationQueueRequest) ProtoMessage() {}
+
+func (x *ListModerationQueueRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[27]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListModerationQueueRequest.ProtoReflect.Descriptor instead.
+func (*ListModerationQueueRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{27}
+}
+
+type ListModerationQueueResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Blogs []*Blog `protobuf:"bytes,1,rep,name=blogs,proto3" json:"blogs,omitempty"` // Held and flagged blogs, oldest first
+}
+
+func (x *ListModerationQueueResponse) Reset() {
+	*x = ListModerationQueueResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[28]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListModerationQueueResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListModerationQueueResponse) ProtoMessage() {}
+
+func (x *ListModerationQueueResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[28]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListModerationQueueResponse.ProtoReflect.Descriptor instead.
+func (*ListModerationQueueResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *ListModerationQueueResponse) GetBlogs() []*Blog {
+	if x != nil {
+		return x.Blogs
+	}
+	return nil
+}
+
+type ReviewBlogRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	BlogId   string                     `protobuf:"bytes,1,opt,name=blog_id,json=blogId,proto3" json:"blog_id,omitempty"`
+	Decision ReviewBlogRequest_Decision `protobuf:"varint,2,opt,name=decision,proto3,enum=blog.ReviewBlogRequest_Decision" json:"decision,omitempty"`
+	Note     string                     `protobuf:"bytes,3,opt,name=note,proto3" json:"note,omitempty"`
+}
+
+func (x *ReviewBlogRequest) Reset() {
+	*x = ReviewBlogRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[29]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReviewBlogRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReviewBlogRequest) ProtoMessage() {}
+
+func (x *ReviewBlogRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[29]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReviewBlogRequest.ProtoReflect.Descriptor instead.
+func (*ReviewBlogRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *ReviewBlogRequest) GetBlogId() string {
+	if x != nil {
+		return x.BlogId
+	}
+	return ""
+}
+
+func (x *ReviewBlogRequest) GetDecision() ReviewBlogRequest_Decision {
+	if x != nil {
+		return x.Decision
+	}
+	return ReviewBlogRequest_UNKNOWN
+}
+
+func (x *ReviewBlogRequest) GetNote() string {
+	if x != nil {
+		return x.Note
+	}
+	return ""
+}
+
+type ReviewBlogResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Blog *Blog `protobuf:"bytes,1,opt,name=blog,proto3" json:"blog,omitempty"`
+}
+
+func (x *ReviewBlogResponse) Reset() {
+	*x = ReviewBlogResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[30]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReviewBlogResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReviewBlogResponse) ProtoMessage() {}
+
+func (x *ReviewBlogResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[30]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReviewBlogResponse.ProtoReflect.Descriptor instead.
+func (*ReviewBlogResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *ReviewBlogResponse) GetBlog() *Blog {
+	if x != nil {
+		return x.Blog
+	}
+	return nil
+}
+
+type Tenant struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name      string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Database  string `protobuf:"bytes,2,opt,name=database,proto3" json:"database,omitempty"`
+	CreatedAt int64  `protobuf:"varint,3,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"` // Unix time in seconds
+}
+
+func (x *Tenant) Reset() {
+	*x = Tenant{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[31]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Tenant) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tenant) ProtoMessage() {}
+
+func (x *Tenant) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[31]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tenant.ProtoReflect.Descriptor instead.
+func (*Tenant) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *Tenant) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Tenant) GetDatabase() string {
+	if x != nil {
+		return x.Database
+	}
+	return ""
+}
+
+func (x *Tenant) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+type CreateTenantRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"` // Lower case letters, digits, '-' and '_'
+}
+
+func (x *CreateTenantRequest) Reset() {
+	*x = CreateTenantRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[32]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateTenantRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateTenantRequest) ProtoMessage() {}
+
+func (x *CreateTenantRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[32]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateTenantRequest.ProtoReflect.Descriptor instead.
+func (*CreateTenantRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{32}
+}
+
+func (x *CreateTenantRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type CreateTenantResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Tenant *Tenant `protobuf:"bytes,1,opt,name=tenant,proto3" json:"tenant,omitempty"`
+}
+
+func (x *CreateTenantResponse) Reset() {
+	*x = CreateTenantResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[33]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateTenantResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateTenantResponse) ProtoMessage() {}
+
+func (x *CreateTenantResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[33]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateTenantResponse.ProtoReflect.Descriptor instead.
+func (*CreateTenantResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{33}
+}
+
+func (x *CreateTenantResponse) GetTenant() *Tenant {
+	if x != nil {
+		return x.Tenant
+	}
+	return nil
+}
+
+type DeleteTenantRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (x *DeleteTenantRequest) Reset() {
+	*x = DeleteTenantRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[34]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteTenantRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteTenantRequest) ProtoMessage() {}
+
+func (x *DeleteTenantRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[34]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteTenantRequest.ProtoReflect.Descriptor instead.
+func (*DeleteTenantRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{34}
+}
+
+func (x *DeleteTenantRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type DeleteTenantResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+}
+
+func (x *DeleteTenantResponse) Reset() {
+	*x = DeleteTenantResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[35]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DeleteTenantResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteTenantResponse) ProtoMessage() {}
+
+func (x *DeleteTenantResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[35]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteTenantResponse.ProtoReflect.Descriptor instead.
+func (*DeleteTenantResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{35}
+}
+
+func (x *DeleteTenantResponse) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+type ListTenantsRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListTenantsRequest) Reset() {
+	*x = ListTenantsRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[36]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListTenantsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTenantsRequest) ProtoMessage() {}
+
+func (x *ListTenantsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[36]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTenantsRequest.ProtoReflect.Descriptor instead.
+func (*ListTenantsRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{36}
+}
+
+type ListTenantsResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Tenants []*Tenant `protobuf:"bytes,1,rep,name=tenants,proto3" json:"tenants,omitempty"`
+}
+
+func (x *ListTenantsResponse) Reset() {
+	*x = ListTenantsResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[37]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListTenantsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListTenantsResponse) ProtoMessage() {}
+
+func (x *ListTenantsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[37]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListTenantsResponse.ProtoReflect.Descriptor instead.
+func (*ListTenantsResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{37}
+}
+
+func (x *ListTenantsResponse) GetTenants() []*Tenant {
+	if x != nil {
+		return x.Tenants
+	}
+	return nil
+}
+
+type ListDuplicateClustersRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+}
+
+func (x *ListDuplicateClustersRequest) Reset() {
+	*x = ListDuplicateClustersRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[38]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListDuplicateClustersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDuplicateClustersRequest) ProtoMessage() {}
+
+func (x *ListDuplicateClustersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[38]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDuplicateClustersRequest.ProtoReflect.Descriptor instead.
+func (*ListDuplicateClustersRequest) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{38}
+}
+
+type DuplicateCluster struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Blogs []*Blog `protobuf:"bytes,1,rep,name=blogs,proto3" json:"blogs,omitempty"` // Only id, author, title, slug and timestamps are set
+}
+
+func (x *DuplicateCluster) Reset() {
+	*x = DuplicateCluster{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[39]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DuplicateCluster) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DuplicateCluster) ProtoMessage() {}
+
+func (x *DuplicateCluster) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[39]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DuplicateCluster.ProtoReflect.Descriptor instead.
+func (*DuplicateCluster) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{39}
+}
+
+func (x *DuplicateCluster) GetBlogs() []*Blog {
+	if x != nil {
+		return x.Blogs
+	}
+	return nil
+}
+
+type ListDuplicateClustersResponse struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Clusters []*DuplicateCluster `protobuf:"bytes,1,rep,name=clusters,proto3" json:"clusters,omitempty"`
+}
+
+func (x *ListDuplicateClustersResponse) Reset() {
+	*x = ListDuplicateClustersResponse{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_blog_pb_blog_proto_msgTypes[40]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListDuplicateClustersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDuplicateClustersResponse) ProtoMessage() {}
+
+func (x *ListDuplicateClustersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_blog_pb_blog_proto_msgTypes[40]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDuplicateClustersResponse.ProtoReflect.Descriptor instead.
+func (*ListDuplicateClustersResponse) Descriptor() ([]byte, []int) {
+	return file_blog_pb_blog_proto_rawDescGZIP(), []int{40}
+}
+
+func (x *ListDuplicateClustersResponse) GetClusters() []*DuplicateCluster {
+	if x != nil {
+		return x.Clusters
+	}
+	return nil
+}
+
+var File_blog_pb_blog_proto protoreflect.FileDescriptor
+
+var file_blog_pb_blog_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x62, 0x6c, 0x6f, 0x67, 0x2f, 0x70, 0x62, 0x2f, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x1a, 0x1c, 0x67, 0x6f, 0x6f, 0x67,
+	0x6c, 0x65, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x61, 0x6e, 0x6e, 0x6f, 0x74, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xaa, 0x04, 0x0a, 0x04, 0x42, 0x6c, 0x6f,
+	0x67, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69,
+	0x64, 0x12, 0x1b, 0x0a, 0x09, 0x61, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x61, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x49, 0x64, 0x12, 0x14,
+	0x0a, 0x05, 0x74, 0x69, 0x74, 0x6c, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x74,
+	0x69, 0x74, 0x6c, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x12, 0x14,
+	0x0a, 0x05, 0x76, 0x69, 0x65, 0x77, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x76,
+	0x69, 0x65, 0x77, 0x73, 0x12, 0x25, 0x0a, 0x0e, 0x72, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e,
+	0x5f, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0d, 0x72, 0x65,
+	0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x37, 0x0a, 0x09, 0x72,
+	0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x07, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19,
+	0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x2e, 0x52, 0x65, 0x61, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x09, 0x72, 0x65, 0x61, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x61, 0x67, 0x73, 0x18, 0x08, 0x20, 0x03,
+	0x28, 0x09, 0x52, 0x04, 0x74, 0x61, 0x67, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x72, 0x65, 0x61,
+	0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x09, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x63, 0x72,
+	0x65, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x70, 0x64, 0x61, 0x74,
+	0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x75, 0x70, 0x64,
+	0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x73, 0x6c, 0x75, 0x67, 0x18, 0x0b,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x73, 0x6c, 0x75, 0x67, 0x12, 0x21, 0x0a, 0x0c, 0x64, 0x75,
+	0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x65, 0x5f, 0x6f, 0x66, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0b, 0x64, 0x75, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x65, 0x4f, 0x66, 0x12, 0x36, 0x0a,
+	0x0a, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x0d, 0x20, 0x01, 0x28,
+	0x0e, 0x32, 0x16, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x0a, 0x6d, 0x6f, 0x64, 0x65, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x2d, 0x0a, 0x12, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74,
+	0x69, 0x6f, 0x6e, 0x5f, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x73, 0x18, 0x0e, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x11, 0x6d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x61,
+	0x73, 0x6f, 0x6e, 0x73, 0x12, 0x21, 0x0a, 0x0c, 0x72, 0x65, 0x76, 0x69, 0x65, 0x77, 0x5f, 0x6e,
+	0x6f, 0x74, 0x65, 0x73, 0x18, 0x0f, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0b, 0x72, 0x65, 0x76, 0x69,
+	0x65, 0x77, 0x4e, 0x6f, 0x74, 0x65, 0x73, 0x1a, 0x3c, 0x0a, 0x0e, 0x52, 0x65, 0x61, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x49, 0x0a, 0x11, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x42,
+	0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c,
+	0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e,
+	0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x6f,
+	0x72, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x66, 0x6f, 0x72, 0x63, 0x65,
+	0x22, 0x34, 0x0a, 0x12, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67,
+	0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x22, 0x2a, 0x0a, 0x0f, 0x52, 0x65, 0x61, 0x64, 0x42, 0x6c,
+	0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x62, 0x6c, 0x6f,
+	0x67, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62, 0x6c, 0x6f, 0x67,
+	0x49, 0x64, 0x22, 0x32, 0x0a, 0x10, 0x52, 0x65, 0x61, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67,
+	0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x22, 0x49, 0x0a, 0x11, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65,
+	0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x04, 0x62,
+	0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67,
+	0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x12, 0x14, 0x0a, 0x05, 0x66,
+	0x6f, 0x72, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x66, 0x6f, 0x72, 0x63,
+	0x65, 0x22, 0x34, 0x0a, 0x12, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f,
+	0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x22, 0x2c, 0x0a, 0x11, 0x44, 0x65, 0x6c, 0x65, 0x74,
+	0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a, 0x07,
+	0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62,
+	0x6c, 0x6f, 0x67, 0x49, 0x64, 0x22, 0x2d, 0x0a, 0x12, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x42,
+	0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x17, 0x0a, 0x07, 0x62,
+	0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62, 0x6c,
+	0x6f, 0x67, 0x49, 0x64, 0x22, 0x66, 0x0a, 0x0f, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x6c, 0x6f, 0x67,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x2e, 0x0a, 0x04, 0x73, 0x6f, 0x72, 0x74, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73,
+	0x74, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x2e, 0x53, 0x6f, 0x72,
+	0x74, 0x52, 0x04, 0x73, 0x6f, 0x72, 0x74, 0x22, 0x23, 0x0a, 0x04, 0x53, 0x6f, 0x72, 0x74, 0x12,
+	0x0b, 0x0a, 0x07, 0x44, 0x45, 0x46, 0x41, 0x55, 0x4c, 0x54, 0x10, 0x00, 0x12, 0x0e, 0x0a, 0x0a,
+	0x50, 0x4f, 0x50, 0x55, 0x4c, 0x41, 0x52, 0x49, 0x54, 0x59, 0x10, 0x01, 0x22, 0x32, 0x0a, 0x10,
+	0x4c, 0x69, 0x73, 0x74, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a,
+	0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67,
+	0x22, 0x62, 0x0a, 0x12, 0x52, 0x65, 0x61, 0x63, 0x74, 0x54, 0x6f, 0x42, 0x6c, 0x6f, 0x67, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69,
+	0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62, 0x6c, 0x6f, 0x67, 0x49, 0x64, 0x12,
+	0x17, 0x0a, 0x07, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x75, 0x73, 0x65, 0x72, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x61, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x72, 0x65, 0x61, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x22, 0x35, 0x0a, 0x13, 0x52, 0x65, 0x61, 0x63, 0x74, 0x54, 0x6f, 0x42,
+	0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1e, 0x0a, 0x04, 0x62,
+	0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67,
+	0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x22, 0x49, 0x0a, 0x15, 0x52,
+	0x65, 0x6d, 0x6f, 0x76, 0x65, 0x52, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a, 0x07, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x62, 0x6c, 0x6f, 0x67, 0x49, 0x64, 0x12, 0x17, 0x0a,
+	0x07, 0x75, 0x73, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x75, 0x73, 0x65, 0x72, 0x49, 0x64, 0x22, 0x38, 0x0a, 0x16, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65,
+	0x52, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a,
+	0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67,
+	0x22, 0x15, 0x0a, 0x13, 0x47, 0x65, 0x74, 0x42, 0x6c, 0x6f, 0x67, 0x53, 0x74, 0x61, 0x74, 0x73,
+	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x34, 0x0a, 0x0a, 0x53, 0x74, 0x61, 0x74, 0x73,
+	0x43, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x05, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x22, 0x99, 0x02,
+	0x0a, 0x14, 0x47, 0x65, 0x74, 0x42, 0x6c, 0x6f, 0x67, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x74, 0x6f, 0x74, 0x61, 0x6c, 0x5f,
+	0x62, 0x6c, 0x6f, 0x67, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0a, 0x74, 0x6f, 0x74,
+	0x61, 0x6c, 0x42, 0x6c, 0x6f, 0x67, 0x73, 0x12, 0x34, 0x0a, 0x16, 0x61, 0x76, 0x65, 0x72, 0x61,
+	0x67, 0x65, 0x5f, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x5f, 0x6c, 0x65, 0x6e, 0x67, 0x74,
+	0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x14, 0x61, 0x76, 0x65, 0x72, 0x61, 0x67, 0x65,
+	0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x4c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x3a, 0x0a,
+	0x10, 0x70, 0x6f, 0x73, 0x74, 0x73, 0x5f, 0x70, 0x65, 0x72, 0x5f, 0x61, 0x75, 0x74, 0x68, 0x6f,
+	0x72, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x53,
+	0x74, 0x61, 0x74, 0x73, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x52, 0x0e, 0x70, 0x6f, 0x73, 0x74, 0x73,
+	0x50, 0x65, 0x72, 0x41, 0x75, 0x74, 0x68, 0x6f, 0x72, 0x12, 0x34, 0x0a, 0x0d, 0x70, 0x6f, 0x73,
+	0x74, 0x73, 0x5f, 0x70, 0x65, 0x72, 0x5f, 0x74, 0x61, 0x67, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x10, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x73, 0x43, 0x6f, 0x75,
+	0x6e, 0x74, 0x52, 0x0b, 0x70, 0x6f, 0x73, 0x74, 0x73, 0x50, 0x65, 0x72, 0x54, 0x61, 0x67, 0x12,
+	0x38, 0x0a, 0x0f, 0x70, 0x6f, 0x73, 0x74, 0x73, 0x5f, 0x70, 0x65, 0x72, 0x5f, 0x6d, 0x6f, 0x6e,
+	0x74, 0x68, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x10, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e,
+	0x53, 0x74, 0x61, 0x74, 0x73, 0x43, 0x6f, 0x75, 0x6e, 0x74, 0x52, 0x0d, 0x70, 0x6f, 0x73, 0x74,
+	0x73, 0x50, 0x65, 0x72, 0x4d, 0x6f, 0x6e, 0x74, 0x68, 0x22, 0x16, 0x0a, 0x14, 0x47, 0x65, 0x74,
+	0x43, 0x61, 0x63, 0x68, 0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x22, 0x79, 0x0a, 0x15, 0x47, 0x65, 0x74, 0x43, 0x61, 0x63, 0x68, 0x65, 0x53, 0x74, 0x61,
+	0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x69,
+	0x74, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x04, 0x68, 0x69, 0x74, 0x73, 0x12, 0x16,
+	0x0a, 0x06, 0x6d, 0x69, 0x73, 0x73, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x06,
+	0x6d, 0x69, 0x73, 0x73, 0x65, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65,
+	0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73,
+	0x12, 0x1a, 0x0a, 0x08, 0x63, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x79, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x03, 0x52, 0x08, 0x63, 0x61, 0x70, 0x61, 0x63, 0x69, 0x74, 0x79, 0x22, 0x9b, 0x01, 0x0a,
+	0x09, 0x42, 0x6c, 0x6f, 0x67, 0x57, 0x72, 0x69, 0x74, 0x65, 0x12, 0x24, 0x0a, 0x06, 0x63, 0x72,
+	0x65, 0x61, 0x74, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f,
+	0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x48, 0x00, 0x52, 0x06, 0x63, 0x72, 0x65, 0x61, 0x74, 0x65,
+	0x12, 0x24, 0x0a, 0x06, 0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x48, 0x00, 0x52, 0x06,
+	0x75, 0x70, 0x64, 0x61, 0x74, 0x65, 0x12, 0x26, 0x0a, 0x0e, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65,
+	0x5f, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00,
+	0x52, 0x0c, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x49, 0x64, 0x12, 0x14,
+	0x0a, 0x05, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x05, 0x66,
+	0x6f, 0x72, 0x63, 0x65, 0x42, 0x04, 0x0a, 0x02, 0x6f, 0x70, 0x22, 0x41, 0x0a, 0x16, 0x42, 0x61,
+	0x74, 0x63, 0x68, 0x57, 0x72, 0x69, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x73, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x27, 0x0a, 0x06, 0x77, 0x72, 0x69, 0x74, 0x65, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x0f, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67,
+	0x57, 0x72, 0x69, 0x74, 0x65, 0x52, 0x06, 0x77, 0x72, 0x69, 0x74, 0x65, 0x73, 0x22, 0x59, 0x0a,
+	0x0f, 0x42, 0x6c, 0x6f, 0x67, 0x57, 0x72, 0x69, 0x74, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74,
+	0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a,
+	0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67,
+	0x12, 0x26, 0x0a, 0x0f, 0x64, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x64, 0x5f, 0x62, 0x6c, 0x6f, 0x67,
+	0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x64, 0x65, 0x6c, 0x65, 0x74,
+	0x65, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x49, 0x64, 0x22, 0x4a, 0x0a, 0x17, 0x42, 0x61, 0x74, 0x63,
+	0x68, 0x57, 0x72, 0x69, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x12, 0x2f, 0x0a, 0x07, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67,
+	0x57, 0x72, 0x69, 0x74, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x52, 0x07, 0x72, 0x65, 0x73,
+	0x75, 0x6c, 0x74, 0x73, 0x22, 0x48, 0x0a, 0x17, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x65, 0x6c, 0x61,
+	0x74, 0x65, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x17, 0x0a, 0x07, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x62, 0x6c, 0x6f, 0x67, 0x49, 0x64, 0x12, 0x14, 0x0a, 0x05, 0x6c, 0x69, 0x6d, 0x69,
+	0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x05, 0x52, 0x05, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x22, 0x43,
+	0x0a, 0x0b, 0x52, 0x65, 0x6c, 0x61, 0x74, 0x65, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x12, 0x1e, 0x0a,
+	0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c,
+	0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x12, 0x14, 0x0a,
+	0x05, 0x73, 0x63, 0x6f, 0x72, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x73, 0x63,
+	0x6f, 0x72, 0x65, 0x22, 0x43, 0x0a, 0x18, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x65, 0x6c, 0x61, 0x74,
+	0x65, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12,
+	0x27, 0x0a, 0x05, 0x62, 0x6c, 0x6f, 0x67, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x11,
+	0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x52, 0x65, 0x6c, 0x61, 0x74, 0x65, 0x64, 0x42, 0x6c, 0x6f,
+	0x67, 0x52, 0x05, 0x62, 0x6c, 0x6f, 0x67, 0x73, 0x22, 0x1c, 0x0a, 0x1a, 0x4c, 0x69, 0x73, 0x74,
+	0x4d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x51, 0x75, 0x65, 0x75, 0x65, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x3f, 0x0a, 0x1b, 0x4c, 0x69, 0x73, 0x74, 0x4d, 0x6f,
+	0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x51, 0x75, 0x65, 0x75, 0x65, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x20, 0x0a, 0x05, 0x62, 0x6c, 0x6f, 0x67, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67,
+	0x52, 0x05, 0x62, 0x6c, 0x6f, 0x67, 0x73, 0x22, 0xb0, 0x01, 0x0a, 0x11, 0x52, 0x65, 0x76, 0x69,
+	0x65, 0x77, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x17, 0x0a,
+	0x07, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
+	0x62, 0x6c, 0x6f, 0x67, 0x49, 0x64, 0x12, 0x3c, 0x0a, 0x08, 0x64, 0x65, 0x63, 0x69, 0x73, 0x69,
+	0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x20, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e,
+	0x52, 0x65, 0x76, 0x69, 0x65, 0x77, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x2e, 0x44, 0x65, 0x63, 0x69, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x08, 0x64, 0x65, 0x63, 0x69,
+	0x73, 0x69, 0x6f, 0x6e, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x6f, 0x74, 0x65, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x04, 0x6e, 0x6f, 0x74, 0x65, 0x22, 0x30, 0x0a, 0x08, 0x44, 0x65, 0x63, 0x69,
+	0x73, 0x69, 0x6f, 0x6e, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10,
+	0x00, 0x12, 0x0b, 0x0a, 0x07, 0x41, 0x50, 0x50, 0x52, 0x4f, 0x56, 0x45, 0x10, 0x01, 0x12, 0x0a,
+	0x0a, 0x06, 0x52, 0x45, 0x4a, 0x45, 0x43, 0x54, 0x10, 0x02, 0x22, 0x34, 0x0a, 0x12, 0x52, 0x65,
+	0x76, 0x69, 0x65, 0x77, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65,
+	0x12, 0x1e, 0x0a, 0x04, 0x62, 0x6c, 0x6f, 0x67, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0a,
+	0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x04, 0x62, 0x6c, 0x6f, 0x67,
+	0x22, 0x57, 0x0a, 0x06, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61,
+	0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1a,
+	0x0a, 0x08, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x64, 0x61, 0x74, 0x61, 0x62, 0x61, 0x73, 0x65, 0x12, 0x1d, 0x0a, 0x0a, 0x63, 0x72,
+	0x65, 0x61, 0x74, 0x65, 0x64, 0x5f, 0x61, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09,
+	0x63, 0x72, 0x65, 0x61, 0x74, 0x65, 0x64, 0x41, 0x74, 0x22, 0x29, 0x0a, 0x13, 0x43, 0x72, 0x65,
+	0x61, 0x74, 0x65, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x6e, 0x61, 0x6d, 0x65, 0x22, 0x3c, 0x0a, 0x14, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54, 0x65,
+	0x6e, 0x61, 0x6e, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x24, 0x0a, 0x06,
+	0x74, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x62,
+	0x6c, 0x6f, 0x67, 0x2e, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x52, 0x06, 0x74, 0x65, 0x6e, 0x61,
+	0x6e, 0x74, 0x22, 0x29, 0x0a, 0x13, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x65, 0x6e, 0x61,
+	0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x2a, 0x0a,
+	0x14, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x22, 0x14, 0x0a, 0x12, 0x4c, 0x69, 0x73,
+	0x74, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22,
+	0x3d, 0x0a, 0x13, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x73, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x26, 0x0a, 0x07, 0x74, 0x65, 0x6e, 0x61, 0x6e, 0x74,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x54,
+	0x65, 0x6e, 0x61, 0x6e, 0x74, 0x52, 0x07, 0x74, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x73, 0x22, 0x1e,
+	0x0a, 0x1c, 0x4c, 0x69, 0x73, 0x74, 0x44, 0x75, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x65, 0x43,
+	0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0x34,
+	0x0a, 0x10, 0x44, 0x75, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x65, 0x43, 0x6c, 0x75, 0x73, 0x74,
+	0x65, 0x72, 0x12, 0x20, 0x0a, 0x05, 0x62, 0x6c, 0x6f, 0x67, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x0a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x05, 0x62,
+	0x6c, 0x6f, 0x67, 0x73, 0x22, 0x53, 0x0a, 0x1d, 0x4c, 0x69, 0x73, 0x74, 0x44, 0x75, 0x70, 0x6c,
+	0x69, 0x63, 0x61, 0x74, 0x65, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x73, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x32, 0x0a, 0x08, 0x63, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72,
+	0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x44,
+	0x75, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x65, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x52,
+	0x08, 0x63, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x73, 0x2a, 0x50, 0x0a, 0x10, 0x4d, 0x6f, 0x64,
+	0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x0d, 0x0a,
+	0x09, 0x50, 0x55, 0x42, 0x4c, 0x49, 0x53, 0x48, 0x45, 0x44, 0x10, 0x00, 0x12, 0x12, 0x0a, 0x0e,
+	0x50, 0x45, 0x4e, 0x44, 0x49, 0x4e, 0x47, 0x5f, 0x52, 0x45, 0x56, 0x49, 0x45, 0x57, 0x10, 0x01,
+	0x12, 0x0b, 0x0a, 0x07, 0x46, 0x4c, 0x41, 0x47, 0x47, 0x45, 0x44, 0x10, 0x02, 0x12, 0x0c, 0x0a,
+	0x08, 0x52, 0x45, 0x4a, 0x45, 0x43, 0x54, 0x45, 0x44, 0x10, 0x03, 0x32, 0xe3, 0x08, 0x0a, 0x0b,
+	0x42, 0x6c, 0x6f, 0x67, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x55, 0x0a, 0x0a, 0x43,
+	0x72, 0x65, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x12, 0x17, 0x2e, 0x62, 0x6c, 0x6f, 0x67,
+	0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x18, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65,
+	0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x14, 0x82, 0xd3,
+	0xe4, 0x93, 0x02, 0x0e, 0x3a, 0x01, 0x2a, 0x22, 0x09, 0x2f, 0x76, 0x31, 0x2f, 0x62, 0x6c, 0x6f,
+	0x67, 0x73, 0x12, 0x56, 0x0a, 0x08, 0x52, 0x65, 0x61, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x12, 0x15,
+	0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x52, 0x65, 0x61, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x52, 0x65, 0x61,
+	0x64, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x1b, 0x82,
+	0xd3, 0xe4, 0x93, 0x02, 0x15, 0x12, 0x13, 0x2f, 0x76, 0x31, 0x2f, 0x62, 0x6c, 0x6f, 0x67, 0x73,
+	0x2f, 0x7b, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x7d, 0x12, 0x5f, 0x0a, 0x0a, 0x55, 0x70,
+	0x64, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x12, 0x17, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e,
+	0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x18, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x42,
+	0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x1e, 0x82, 0xd3, 0xe4,
+	0x93, 0x02, 0x18, 0x3a, 0x01, 0x2a, 0x1a, 0x13, 0x2f, 0x76, 0x31, 0x2f, 0x62, 0x6c, 0x6f, 0x67,
+	0x73, 0x2f, 0x7b, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x69, 0x64, 0x7d, 0x12, 0x5c, 0x0a, 0x0a, 0x44,
+	0x65, 0x6c, 0x65, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x12, 0x17, 0x2e, 0x62, 0x6c, 0x6f, 0x67,
+	0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x18, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65,
+	0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x1b, 0x82, 0xd3,
+	0xe4, 0x93, 0x02, 0x15, 0x2a, 0x13, 0x2f, 0x76, 0x31, 0x2f, 0x62, 0x6c, 0x6f, 0x67, 0x73, 0x2f,
+	0x7b, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x7d, 0x12, 0x4e, 0x0a, 0x08, 0x4c, 0x69, 0x73,
+	0x74, 0x42, 0x6c, 0x6f, 0x67, 0x12, 0x15, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73,
+	0x74, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x16, 0x2e, 0x62,
+	0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x11, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x0b, 0x12, 0x09, 0x2f, 0x76,
+	0x31, 0x2f, 0x62, 0x6c, 0x6f, 0x67, 0x73, 0x30, 0x01, 0x12, 0x6c, 0x0a, 0x0b, 0x52, 0x65, 0x61,
+	0x63, 0x74, 0x54, 0x6f, 0x42, 0x6c, 0x6f, 0x67, 0x12, 0x18, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e,
+	0x52, 0x65, 0x61, 0x63, 0x74, 0x54, 0x6f, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x19, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x52, 0x65, 0x61, 0x63, 0x74, 0x54,
+	0x6f, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x28, 0x82,
+	0xd3, 0xe4, 0x93, 0x02, 0x22, 0x3a, 0x01, 0x2a, 0x22, 0x1d, 0x2f, 0x76, 0x31, 0x2f, 0x62, 0x6c,
+	0x6f, 0x67, 0x73, 0x2f, 0x7b, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x7d, 0x2f, 0x72, 0x65,
+	0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x7c, 0x0a, 0x0e, 0x52, 0x65, 0x6d, 0x6f, 0x76,
+	0x65, 0x52, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x1b, 0x2e, 0x62, 0x6c, 0x6f, 0x67,
+	0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x52, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1c, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x52, 0x65,
+	0x6d, 0x6f, 0x76, 0x65, 0x52, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x22, 0x2f, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x29, 0x2a, 0x27, 0x2f, 0x76,
+	0x31, 0x2f, 0x62, 0x6c, 0x6f, 0x67, 0x73, 0x2f, 0x7b, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64,
+	0x7d, 0x2f, 0x72, 0x65, 0x61, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2f, 0x7b, 0x75, 0x73, 0x65,
+	0x72, 0x5f, 0x69, 0x64, 0x7d, 0x12, 0x5e, 0x0a, 0x0c, 0x47, 0x65, 0x74, 0x42, 0x6c, 0x6f, 0x67,
+	0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x19, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x47, 0x65, 0x74,
+	0x42, 0x6c, 0x6f, 0x67, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x1a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x47, 0x65, 0x74, 0x42, 0x6c, 0x6f, 0x67, 0x53,
+	0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x17, 0x82, 0xd3,
+	0xe4, 0x93, 0x02, 0x11, 0x12, 0x0f, 0x2f, 0x76, 0x31, 0x2f, 0x73, 0x74, 0x61, 0x74, 0x73, 0x2f,
+	0x62, 0x6c, 0x6f, 0x67, 0x73, 0x12, 0x61, 0x0a, 0x0d, 0x47, 0x65, 0x74, 0x43, 0x61, 0x63, 0x68,
+	0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x12, 0x1a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x47, 0x65,
+	0x74, 0x43, 0x61, 0x63, 0x68, 0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x1a, 0x1b, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x47, 0x65, 0x74, 0x43, 0x61, 0x63,
+	0x68, 0x65, 0x53, 0x74, 0x61, 0x74, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22,
+	0x17, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x11, 0x12, 0x0f, 0x2f, 0x76, 0x31, 0x2f, 0x73, 0x74, 0x61,
+	0x74, 0x73, 0x2f, 0x63, 0x61, 0x63, 0x68, 0x65, 0x12, 0x6f, 0x0a, 0x0f, 0x42, 0x61, 0x74, 0x63,
+	0x68, 0x57, 0x72, 0x69, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x73, 0x12, 0x1c, 0x2e, 0x62, 0x6c,
+	0x6f, 0x67, 0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x57, 0x72, 0x69, 0x74, 0x65, 0x42, 0x6c, 0x6f,
+	0x67, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1d, 0x2e, 0x62, 0x6c, 0x6f, 0x67,
+	0x2e, 0x42, 0x61, 0x74, 0x63, 0x68, 0x57, 0x72, 0x69, 0x74, 0x65, 0x42, 0x6c, 0x6f, 0x67, 0x73,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x1f, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x19,
+	0x3a, 0x01, 0x2a, 0x22, 0x14, 0x2f, 0x76, 0x31, 0x2f, 0x62, 0x6c, 0x6f, 0x67, 0x73, 0x3a, 0x62,
+	0x61, 0x74, 0x63, 0x68, 0x57, 0x72, 0x69, 0x74, 0x65, 0x12, 0x76, 0x0a, 0x10, 0x4c, 0x69, 0x73,
+	0x74, 0x52, 0x65, 0x6c, 0x61, 0x74, 0x65, 0x64, 0x42, 0x6c, 0x6f, 0x67, 0x73, 0x12, 0x1d, 0x2e,
+	0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x65, 0x6c, 0x61, 0x74, 0x65, 0x64,
+	0x42, 0x6c, 0x6f, 0x67, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1e, 0x2e, 0x62,
+	0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x65, 0x6c, 0x61, 0x74, 0x65, 0x64, 0x42,
+	0x6c, 0x6f, 0x67, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x22, 0x23, 0x82, 0xd3,
+	0xe4, 0x93, 0x02, 0x1d, 0x12, 0x1b, 0x2f, 0x76, 0x31, 0x2f, 0x62, 0x6c, 0x6f, 0x67, 0x73, 0x2f,
+	0x7b, 0x62, 0x6c, 0x6f, 0x67, 0x5f, 0x69, 0x64, 0x7d, 0x2f, 0x72, 0x65, 0x6c, 0x61, 0x74, 0x65,
+	0x64, 0x32, 0xe3, 0x03, 0x0a, 0x10, 0x42, 0x6c, 0x6f, 0x67, 0x41, 0x64, 0x6d, 0x69, 0x6e, 0x53,
+	0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x45, 0x0a, 0x0c, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65,
+	0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x12, 0x19, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x43, 0x72,
+	0x65, 0x61, 0x74, 0x65, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x1a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x54,
+	0x65, 0x6e, 0x61, 0x6e, 0x74, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x45, 0x0a,
+	0x0c, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x12, 0x19, 0x2e,
+	0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x65, 0x6e, 0x61, 0x6e,
+	0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x1a, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e,
+	0x44, 0x65, 0x6c, 0x65, 0x74, 0x65, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x52, 0x65, 0x73, 0x70,
+	0x6f, 0x6e, 0x73, 0x65, 0x12, 0x42, 0x0a, 0x0b, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x65, 0x6e, 0x61,
+	0x6e, 0x74, 0x73, 0x12, 0x18, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x54,
+	0x65, 0x6e, 0x61, 0x6e, 0x74, 0x73, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e,
+	0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x54, 0x65, 0x6e, 0x61, 0x6e, 0x74, 0x73,
+	0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x60, 0x0a, 0x15, 0x4c, 0x69, 0x73, 0x74,
+	0x44, 0x75, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x65, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72,
+	0x73, 0x12, 0x22, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x44, 0x75, 0x70,
+	0x6c, 0x69, 0x63, 0x61, 0x74, 0x65, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x73, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x23, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73,
+	0x74, 0x44, 0x75, 0x70, 0x6c, 0x69, 0x63, 0x61, 0x74, 0x65, 0x43, 0x6c, 0x75, 0x73, 0x74, 0x65,
+	0x72, 0x73, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x5a, 0x0a, 0x13, 0x4c, 0x69,
+	0x73, 0x74, 0x4d, 0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x51, 0x75, 0x65, 0x75,
+	0x65, 0x12, 0x20, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x4d, 0x6f, 0x64,
+	0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x51, 0x75, 0x65, 0x75, 0x65, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x21, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x4d,
+	0x6f, 0x64, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x51, 0x75, 0x65, 0x75, 0x65, 0x52, 0x65,
+	0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x12, 0x3f, 0x0a, 0x0a, 0x52, 0x65, 0x76, 0x69, 0x65, 0x77,
+	0x42, 0x6c, 0x6f, 0x67, 0x12, 0x17, 0x2e, 0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x52, 0x65, 0x76, 0x69,
+	0x65, 0x77, 0x42, 0x6c, 0x6f, 0x67, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x18, 0x2e,
+	0x62, 0x6c, 0x6f, 0x67, 0x2e, 0x52, 0x65, 0x76, 0x69, 0x65, 0x77, 0x42, 0x6c, 0x6f, 0x67, 0x52,
+	0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x42, 0x35, 0x5a, 0x33, 0x67, 0x69, 0x74, 0x68, 0x75,
+	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x6e, 0x64, 0x72, 0x65, 0x61, 0x73, 0x61, 0x74, 0x6c,
+	0x65, 0x2f, 0x55, 0x64, 0x65, 0x6d, 0x79, 0x2f, 0x67, 0x72, 0x70, 0x63, 0x2d, 0x67, 0x6f, 0x2d,
+	0x63, 0x6f, 0x75, 0x72, 0x73, 0x65, 0x2f, 0x62, 0x6c, 0x6f, 0x67, 0x2f, 0x70, 0x62, 0x62, 0x06,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_blog_pb_blog_proto_rawDescOnce sync.Once
+	file_blog_pb_blog_proto_rawDescData = file_blog_pb_blog_proto_rawDesc
+)
+
+func file_blog_pb_blog_proto_rawDescGZIP() []byte {
+	file_blog_pb_blog_proto_rawDescOnce.Do(func() {
+		file_blog_pb_blog_proto_rawDescData = protoimpl.X.CompressGZIP(file_blog_pb_blog_proto_rawDescData)
+	})
+	return file_blog_pb_blog_proto_rawDescData
+}
+
+var file_blog_pb_blog_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
+var file_blog_pb_blog_proto_msgTypes = make([]protoimpl.MessageInfo, 42)
+var file_blog_pb_blog_proto_goTypes = []interface{}{
+	(ModerationStatus)(0),                 // 0: blog.ModerationStatus
+	(ListBlogRequest_Sort)(0),             // 1: blog.ListBlogRequest.Sort
+	(ReviewBlogRequest_Decision)(0),       // 2: blog.ReviewBlogRequest.Decision
+	(*Blog)(nil),                          // 3: blog.Blog
+	(*CreateBlogRequest)(nil),             // 4: blog.CreateBlogRequest
+	(*CreateBlogResponse)(nil),            // 5: blog.CreateBlogResponse
+	(*ReadBlogRequest)(nil),               // 6: blog.ReadBlogRequest
+	(*ReadBlogResponse)(nil),              // 7: blog.ReadBlogResponse
+	(*UpdateBlogRequest)(nil),             // 8: blog.UpdateBlogRequest
+	(*UpdateBlogResponse)(nil),            // 9: blog.UpdateBlogResponse
+	(*DeleteBlogRequest)(nil),             // 10: blog.DeleteBlogRequest
+	(*DeleteBlogResponse)(nil),            // 11: blog.DeleteBlogResponse
+	(*ListBlogRequest)(nil),               // 12: blog.ListBlogRequest
+	(*ListBlogResponse)(nil),              // 13: blog.ListBlogResponse
+	(*ReactToBlogRequest)(nil),            // 14: blog.ReactToBlogRequest
+	(*ReactToBlogResponse)(nil),           // 15: blog.ReactToBlogResponse
+	(*RemoveReactionRequest)(nil),         // 16: blog.RemoveReactionRequest
+	(*RemoveReactionResponse)(nil),        // 17: blog.RemoveReactionResponse
+	(*GetBlogStatsRequest)(nil),           // 18: blog.GetBlogStatsRequest
+	(*StatsCount)(nil),                    // 19: blog.StatsCount
+	(*GetBlogStatsResponse)(nil),          // 20: blog.GetBlogStatsResponse
+	(*GetCacheStatsRequest)(nil),          // 21: blog.GetCacheStatsRequest
+	(*GetCacheStatsResponse)(nil),         // 22: blog.GetCacheStatsResponse
+	(*BlogWrite)(nil),                     // 23: blog.BlogWrite
+	(*BatchWriteBlogsRequest)(nil),        // 24: blog.BatchWriteBlogsRequest
+	(*BlogWriteResult)(nil),               // 25: blog.BlogWriteResult
+	(*BatchWriteBlogsResponse)(nil),       // 26: blog.BatchWriteBlogsResponse
+	(*ListRelatedBlogsRequest)(nil),       // 27: blog.ListRelatedBlogsRequest
+	(*RelatedBlog)(nil),                   // 28: blog.RelatedBlog
+	(*ListRelatedBlogsResponse)(nil),      // 29: blog.ListRelatedBlogsResponse
+	(*ListModerationQueueRequest)(nil),    // 30: blog.ListModerationQueueRequest
+	(*ListModerationQueueResponse)(nil),   // 31: blog.ListModerationQueueResponse
+	(*ReviewBlogRequest)(nil),             // 32: blog.ReviewBlogRequest
+	(*ReviewBlogResponse)(nil),            // 33: blog.ReviewBlogResponse
+	(*Tenant)(nil),                        // 34: blog.Tenant
+	(*CreateTenantRequest)(nil),           // 35: blog.CreateTenantRequest
+	(*CreateTenantResponse)(nil),          // 36: blog.CreateTenantResponse
+	(*DeleteTenantRequest)(nil),           // 37: blog.DeleteTenantRequest
+	(*DeleteTenantResponse)(nil),          // 38: blog.DeleteTenantResponse
+	(*ListTenantsRequest)(nil),            // 39: blog.ListTenantsRequest
+	(*ListTenantsResponse)(nil),           // 40: blog.ListTenantsResponse
+	(*ListDuplicateClustersRequest)(nil),  // 41: blog.ListDuplicateClustersRequest
+	(*DuplicateCluster)(nil),              // 42: blog.DuplicateCluster
+	(*ListDuplicateClustersResponse)(nil), // 43: blog.ListDuplicateClustersResponse
+	nil,                                   // 44: blog.Blog.ReactionsEntry
+}
+var file_blog_pb_blog_proto_depIdxs = []int32{
+	44, // 0: blog.Blog.reactions:type_name -> blog.Blog.ReactionsEntry
+	0,  // 1: blog.Blog.moderation:type_name -> blog.ModerationStatus
+	3,  // 2: blog.CreateBlogRequest.blog:type_name -> blog.Blog
+	3,  // 3: blog.CreateBlogResponse.blog:type_name -> blog.Blog
+	3,  // 4: blog.ReadBlogResponse.blog:type_name -> blog.Blog
+	3,  // 5: blog.UpdateBlogRequest.blog:type_name -> blog.Blog
+	3,  // 6: blog.UpdateBlogResponse.blog:type_name -> blog.Blog
+	1,  // 7: blog.ListBlogRequest.sort:type_name -> blog.ListBlogRequest.Sort
+	3,  // 8: blog.ListBlogResponse.blog:type_name -> blog.Blog
+	3,  // 9: blog.ReactToBlogResponse.blog:type_name -> blog.Blog
+	3,  // 10: blog.RemoveReactionResponse.blog:type_name -> blog.Blog
+	19, // 11: blog.GetBlogStatsResponse.posts_per_author:type_name -> blog.StatsCount
+	19, // 12: blog.GetBlogStatsResponse.posts_per_tag:type_name -> blog.StatsCount
+	19, // 13: blog.GetBlogStatsResponse.posts_per_month:type_name -> blog.StatsCount
+	3,  // 14: blog.BlogWrite.create:type_name -> blog.Blog
+	3,  // 15: blog.BlogWrite.update:type_name -> blog.Blog
+	23, // 16: blog.BatchWriteBlogsRequest.writes:type_name -> blog.BlogWrite
+	3,  // 17: blog.BlogWriteResult.blog:type_name -> blog.Blog
+	25, // 18: blog.BatchWriteBlogsResponse.results:type_name -> blog.BlogWriteResult
+	3,  // 19: blog.RelatedBlog.blog:type_name -> blog.Blog
+	28, // 20: blog.ListRelatedBlogsResponse.blogs:type_name -> blog.RelatedBlog
+	3,  // 21: blog.ListModerationQueueResponse.blogs:type_name -> blog.Blog
+	2,  // 22: blog.ReviewBlogRequest.decision:type_name -> blog.ReviewBlogRequest.Decision
+	3,  // 23: blog.ReviewBlogResponse.blog:type_name -> blog.Blog
+	34, // 24: blog.CreateTenantResponse.tenant:type_name -> blog.Tenant
+	34, // 25: blog.ListTenantsResponse.tenants:type_name -> blog.Tenant
+	3,  // 26: blog.DuplicateCluster.blogs:type_name -> blog.Blog
+	42, // 27: blog.ListDuplicateClustersResponse.clusters:type_name -> blog.DuplicateCluster
+	4,  // 28: blog.BlogService.CreateBlog:input_type -> blog.CreateBlogRequest
+	6,  // 29: blog.BlogService.ReadBlog:input_type -> blog.ReadBlogRequest
+	8,  // 30: blog.BlogService.UpdateBlog:input_type -> blog.UpdateBlogRequest
+	10, // 31: blog.BlogService.DeleteBlog:input_type -> blog.DeleteBlogRequest
+	12, // 32: blog.BlogService.ListBlog:input_type -> blog.ListBlogRequest
+	14, // 33: blog.BlogService.ReactToBlog:input_type -> blog.ReactToBlogRequest
+	16, // 34: blog.BlogService.RemoveReaction:input_type -> blog.RemoveReactionRequest
+	18, // 35: blog.BlogService.GetBlogStats:input_type -> blog.GetBlogStatsRequest
+	21, // 36: blog.BlogService.GetCacheStats:input_type -> blog.GetCacheStatsRequest
+	24, // 37: blog.BlogService.BatchWriteBlogs:input_type -> blog.BatchWriteBlogsRequest
+	27, // 38: blog.BlogService.ListRelatedBlogs:input_type -> blog.ListRelatedBlogsRequest
+	35, // 39: blog.BlogAdminService.CreateTenant:input_type -> blog.CreateTenantRequest
+	37, // 40: blog.BlogAdminService.DeleteTenant:input_type -> blog.DeleteTenantRequest
+	39, // 41: blog.BlogAdminService.ListTenants:input_type -> blog.ListTenantsRequest
+	41, // 42: blog.BlogAdminService.ListDuplicateClusters:input_type -> blog.ListDuplicateClustersRequest
+	30, // 43: blog.BlogAdminService.ListModerationQueue:input_type -> blog.ListModerationQueueRequest
+	32, // 44: blog.BlogAdminService.ReviewBlog:input_type -> blog.ReviewBlogRequest
+	5,  // 45: blog.BlogService.CreateBlog:output_type -> blog.CreateBlogResponse
+	7,  // 46: blog.BlogService.ReadBlog:output_type -> blog.ReadBlogResponse
+	9,  // 47: blog.BlogService.UpdateBlog:output_type -> blog.UpdateBlogResponse
+	11, // 48: blog.BlogService.DeleteBlog:output_type -> blog.DeleteBlogResponse
+	13, // 49: blog.BlogService.ListBlog:output_type -> blog.ListBlogResponse
+	15, // 50: blog.BlogService.ReactToBlog:output_type -> blog.ReactToBlogResponse
+	17, // 51: blog.BlogService.RemoveReaction:output_type -> blog.RemoveReactionResponse
+	20, // 52: blog.BlogService.GetBlogStats:output_type -> blog.GetBlogStatsResponse
+	22, // 53: blog.BlogService.GetCacheStats:output_type -> blog.GetCacheStatsResponse
+	26, // 54: blog.BlogService.BatchWriteBlogs:output_type -> blog.BatchWriteBlogsResponse
+	29, // 55: blog.BlogService.ListRelatedBlogs:output_type -> blog.ListRelatedBlogsResponse
+	36, // 56: blog.BlogAdminService.CreateTenant:output_type -> blog.CreateTenantResponse
+	38, // 57: blog.BlogAdminService.DeleteTenant:output_type -> blog.DeleteTenantResponse
+	40, // 58: blog.BlogAdminService.ListTenants:output_type -> blog.ListTenantsResponse
+	43, // 59: blog.BlogAdminService.ListDuplicateClusters:output_type -> blog.ListDuplicateClustersResponse
+	31, // 60: blog.BlogAdminService.ListModerationQueue:output_type -> blog.ListModerationQueueResponse
+	33, // 61: blog.BlogAdminService.ReviewBlog:output_type -> blog.ReviewBlogResponse
+	45, // [45:62] is the sub-list for method output_type
+	28, // [28:45] is the sub-list for method input_type
+	28, // [28:28] is the sub-list for extension type_name
+	28, // [28:28] is the sub-list for extension extendee
+	0,  // [0:28] is the sub-list for field type_name
+}
+
+func init() { file_blog_pb_blog_proto_init() }
+func file_blog_pb_blog_proto_init() {
+	if File_blog_pb_blog_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_blog_pb_blog_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Blog); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateBlogRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateBlogResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReadBlogRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReadBlogResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UpdateBlogRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*UpdateBlogResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteBlogRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteBlogResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListBlogRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListBlogResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReactToBlogRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReactToBlogResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RemoveReactionRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RemoveReactionResponse); i {
+			case 0:
 				return &v.state
 			case 1:
 				return &v.sizeCache
@@ -742,8 +3031,8 @@ func file_blog_pb_blog_proto_init() {
 				return nil
 			}
 		}
-		file_blog_pb_blog_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*UpdateBlogRequest); i {
+		file_blog_pb_blog_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetBlogStatsRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -754,8 +3043,8 @@ func file_blog_pb_blog_proto_init() {
 				return nil
 			}
 		}
-		file_blog_pb_blog_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*UpdateBlogResponse); i {
+		file_blog_pb_blog_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*StatsCount); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -766,8 +3055,8 @@ func file_blog_pb_blog_proto_init() {
 				return nil
 			}
 		}
-		file_blog_pb_blog_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*DeleteBlogRequest); i {
+		file_blog_pb_blog_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetBlogStatsResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -778,8 +3067,8 @@ func file_blog_pb_blog_proto_init() {
 				return nil
 			}
 		}
-		file_blog_pb_blog_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*DeleteBlogResponse); i {
+		file_blog_pb_blog_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetCacheStatsRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -790,8 +3079,8 @@ func file_blog_pb_blog_proto_init() {
 				return nil
 			}
 		}
-		file_blog_pb_blog_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ListBlogRequest); i {
+		file_blog_pb_blog_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*GetCacheStatsResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -802,8 +3091,248 @@ func file_blog_pb_blog_proto_init() {
 				return nil
 			}
 		}
-		file_blog_pb_blog_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ListBlogResponse); i {
+		file_blog_pb_blog_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BlogWrite); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchWriteBlogsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[22].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BlogWriteResult); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[23].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*BatchWriteBlogsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[24].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListRelatedBlogsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[25].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RelatedBlog); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[26].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListRelatedBlogsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[27].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListModerationQueueRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[28].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListModerationQueueResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[29].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReviewBlogRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[30].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReviewBlogResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[31].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Tenant); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[32].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateTenantRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[33].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CreateTenantResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[34].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteTenantRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[35].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DeleteTenantResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[36].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListTenantsRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[37].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListTenantsResponse); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[38].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListDuplicateClustersRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[39].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*DuplicateCluster); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_blog_pb_blog_proto_msgTypes[40].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListDuplicateClustersResponse); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -815,18 +3344,24 @@ func file_blog_pb_blog_proto_init() {
 			}
 		}
 	}
+	file_blog_pb_blog_proto_msgTypes[20].OneofWrappers = []interface{}{
+		(*BlogWrite_Create)(nil),
+		(*BlogWrite_Update)(nil),
+		(*BlogWrite_DeleteBlogId)(nil),
+	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_blog_pb_blog_proto_rawDesc,
-			NumEnums:      0,
-			NumMessages:   11,
+			NumEnums:      3,
+			NumMessages:   42,
 			NumExtensions: 0,
-			NumServices:   1,
+			NumServices:   2,
 		},
 		GoTypes:           file_blog_pb_blog_proto_goTypes,
 		DependencyIndexes: file_blog_pb_blog_proto_depIdxs,
+		EnumInfos:         file_blog_pb_blog_proto_enumTypes,
 		MessageInfos:      file_blog_pb_blog_proto_msgTypes,
 	}.Build()
 	File_blog_pb_blog_proto = out.File
@@ -847,13 +3382,31 @@ const _ = grpc.SupportPackageIsVersion6
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
 type BlogServiceClient interface {
+	// return ALREADY_EXISTS if the content nearly matches another blog
+	// return INVALID_ARGUMENT if rejected by moderation
 	CreateBlog(ctx context.Context, in *CreateBlogRequest, opts ...grpc.CallOption) (*CreateBlogResponse, error)
-	// return NOT_FOUND if blog not found
+	// return NOT_FOUND if blog not found or hidden by moderation, increments the view counter
 	ReadBlog(ctx context.Context, in *ReadBlogRequest, opts ...grpc.CallOption) (*ReadBlogResponse, error)
 	// return NOT_FOUND if blog not found
+	// return ALREADY_EXISTS if the content nearly matches another blog
+	// return INVALID_ARGUMENT if rejected by moderation
 	UpdateBlog(ctx context.Context, in *UpdateBlogRequest, opts ...grpc.CallOption) (*UpdateBlogResponse, error)
 	DeleteBlog(ctx context.Context, in *DeleteBlogRequest, opts ...grpc.CallOption) (*DeleteBlogResponse, error)
 	ListBlog(ctx context.Context, in *ListBlogRequest, opts ...grpc.CallOption) (BlogService_ListBlogClient, error)
+	// A user has at most one reaction per blog, reacting again replaces it
+	// return NOT_FOUND if blog not found or hidden by moderation
+	ReactToBlog(ctx context.Context, in *ReactToBlogRequest, opts ...grpc.CallOption) (*ReactToBlogResponse, error)
+	// return NOT_FOUND if blog not found or hidden by moderation
+	RemoveReaction(ctx context.Context, in *RemoveReactionRequest, opts ...grpc.CallOption) (*RemoveReactionResponse, error)
+	GetBlogStats(ctx context.Context, in *GetBlogStatsRequest, opts ...grpc.CallOption) (*GetBlogStatsResponse, error)
+	// Hit and miss counters of the server side read cache
+	GetCacheStats(ctx context.Context, in *GetCacheStatsRequest, opts ...grpc.CallOption) (*GetCacheStatsResponse, error)
+	// Applies all writes in a single transaction, either all of them succeed
+	// or none is applied. The error of the first failing write is returned.
+	BatchWriteBlogs(ctx context.Context, in *BatchWriteBlogsRequest, opts ...grpc.CallOption) (*BatchWriteBlogsResponse, error)
+	// Blogs with similar titles and contents, by TF-IDF
+	// return NOT_FOUND if blog not found
+	ListRelatedBlogs(ctx context.Context, in *ListRelatedBlogsRequest, opts ...grpc.CallOption) (*ListRelatedBlogsResponse, error)
 }
 
 type blogServiceClient struct {
@@ -929,18 +3482,90 @@ func (x *blogServiceListBlogClient) Recv() (*ListBlogResponse, error) {
 	if err := x.ClientStream.RecvMsg(m); err != nil {
 		return nil, err
 	}
-	return m, nil
+	return m, nil
+}
+
+func (c *blogServiceClient) ReactToBlog(ctx context.Context, in *ReactToBlogRequest, opts ...grpc.CallOption) (*ReactToBlogResponse, error) {
+	out := new(ReactToBlogResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/ReactToBlog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) RemoveReaction(ctx context.Context, in *RemoveReactionRequest, opts ...grpc.CallOption) (*RemoveReactionResponse, error) {
+	out := new(RemoveReactionResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/RemoveReaction", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) GetBlogStats(ctx context.Context, in *GetBlogStatsRequest, opts ...grpc.CallOption) (*GetBlogStatsResponse, error) {
+	out := new(GetBlogStatsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/GetBlogStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) GetCacheStats(ctx context.Context, in *GetCacheStatsRequest, opts ...grpc.CallOption) (*GetCacheStatsResponse, error) {
+	out := new(GetCacheStatsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/GetCacheStats", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) BatchWriteBlogs(ctx context.Context, in *BatchWriteBlogsRequest, opts ...grpc.CallOption) (*BatchWriteBlogsResponse, error) {
+	out := new(BatchWriteBlogsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/BatchWriteBlogs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogServiceClient) ListRelatedBlogs(ctx context.Context, in *ListRelatedBlogsRequest, opts ...grpc.CallOption) (*ListRelatedBlogsResponse, error) {
+	out := new(ListRelatedBlogsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogService/ListRelatedBlogs", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
 // BlogServiceServer is the server API for BlogService service.
 type BlogServiceServer interface {
+	// return ALREADY_EXISTS if the content nearly matches another blog
+	// return INVALID_ARGUMENT if rejected by moderation
 	CreateBlog(context.Context, *CreateBlogRequest) (*CreateBlogResponse, error)
-	// return NOT_FOUND if blog not found
+	// return NOT_FOUND if blog not found or hidden by moderation, increments the view counter
 	ReadBlog(context.Context, *ReadBlogRequest) (*ReadBlogResponse, error)
 	// return NOT_FOUND if blog not found
+	// return ALREADY_EXISTS if the content nearly matches another blog
+	// return INVALID_ARGUMENT if rejected by moderation
 	UpdateBlog(context.Context, *UpdateBlogRequest) (*UpdateBlogResponse, error)
 	DeleteBlog(context.Context, *DeleteBlogRequest) (*DeleteBlogResponse, error)
 	ListBlog(*ListBlogRequest, BlogService_ListBlogServer) error
+	// A user has at most one reaction per blog, reacting again replaces it
+	// return NOT_FOUND if blog not found or hidden by moderation
+	ReactToBlog(context.Context, *ReactToBlogRequest) (*ReactToBlogResponse, error)
+	// return NOT_FOUND if blog not found or hidden by moderation
+	RemoveReaction(context.Context, *RemoveReactionRequest) (*RemoveReactionResponse, error)
+	GetBlogStats(context.Context, *GetBlogStatsRequest) (*GetBlogStatsResponse, error)
+	// Hit and miss counters of the server side read cache
+	GetCacheStats(context.Context, *GetCacheStatsRequest) (*GetCacheStatsResponse, error)
+	// Applies all writes in a single transaction, either all of them succeed
+	// or none is applied. The error of the first failing write is returned.
+	BatchWriteBlogs(context.Context, *BatchWriteBlogsRequest) (*BatchWriteBlogsResponse, error)
+	// Blogs with similar titles and contents, by TF-IDF
+	// return NOT_FOUND if blog not found
+	ListRelatedBlogs(context.Context, *ListRelatedBlogsRequest) (*ListRelatedBlogsResponse, error)
 }
 
 // UnimplementedBlogServiceServer can be embedded to have forward compatible implementations.
@@ -962,6 +3587,24 @@ func (*UnimplementedBlogServiceServer) DeleteBlog(context.Context, *DeleteBlogRe
 func (*UnimplementedBlogServiceServer) ListBlog(*ListBlogRequest, BlogService_ListBlogServer) error {
 	return status.Errorf(codes.Unimplemented, "method ListBlog not implemented")
 }
+func (*UnimplementedBlogServiceServer) ReactToBlog(context.Context, *ReactToBlogRequest) (*ReactToBlogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReactToBlog not implemented")
+}
+func (*UnimplementedBlogServiceServer) RemoveReaction(context.Context, *RemoveReactionRequest) (*RemoveReactionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveReaction not implemented")
+}
+func (*UnimplementedBlogServiceServer) GetBlogStats(context.Context, *GetBlogStatsRequest) (*GetBlogStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetBlogStats not implemented")
+}
+func (*UnimplementedBlogServiceServer) GetCacheStats(context.Context, *GetCacheStatsRequest) (*GetCacheStatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCacheStats not implemented")
+}
+func (*UnimplementedBlogServiceServer) BatchWriteBlogs(context.Context, *BatchWriteBlogsRequest) (*BatchWriteBlogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchWriteBlogs not implemented")
+}
+func (*UnimplementedBlogServiceServer) ListRelatedBlogs(context.Context, *ListRelatedBlogsRequest) (*ListRelatedBlogsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListRelatedBlogs not implemented")
+}
 
 func RegisterBlogServiceServer(s *grpc.Server, srv BlogServiceServer) {
 	s.RegisterService(&_BlogService_serviceDesc, srv)
@@ -1060,6 +3703,114 @@ func (x *blogServiceListBlogServer) Send(m *ListBlogResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _BlogService_ReactToBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReactToBlogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).ReactToBlog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/ReactToBlog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).ReactToBlog(ctx, req.(*ReactToBlogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_RemoveReaction_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveReactionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).RemoveReaction(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/RemoveReaction",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).RemoveReaction(ctx, req.(*RemoveReactionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_GetBlogStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetBlogStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).GetBlogStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/GetBlogStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).GetBlogStats(ctx, req.(*GetBlogStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_GetCacheStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCacheStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).GetCacheStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/GetCacheStats",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).GetCacheStats(ctx, req.(*GetCacheStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_BatchWriteBlogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchWriteBlogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).BatchWriteBlogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/BatchWriteBlogs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).BatchWriteBlogs(ctx, req.(*BatchWriteBlogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogService_ListRelatedBlogs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRelatedBlogsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogServiceServer).ListRelatedBlogs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogService/ListRelatedBlogs",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogServiceServer).ListRelatedBlogs(ctx, req.(*ListRelatedBlogsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _BlogService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "blog.BlogService",
 	HandlerType: (*BlogServiceServer)(nil),
@@ -1080,6 +3831,30 @@ var _BlogService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteBlog",
 			Handler:    _BlogService_DeleteBlog_Handler,
 		},
+		{
+			MethodName: "ReactToBlog",
+			Handler:    _BlogService_ReactToBlog_Handler,
+		},
+		{
+			MethodName: "RemoveReaction",
+			Handler:    _BlogService_RemoveReaction_Handler,
+		},
+		{
+			MethodName: "GetBlogStats",
+			Handler:    _BlogService_GetBlogStats_Handler,
+		},
+		{
+			MethodName: "GetCacheStats",
+			Handler:    _BlogService_GetCacheStats_Handler,
+		},
+		{
+			MethodName: "BatchWriteBlogs",
+			Handler:    _BlogService_BatchWriteBlogs_Handler,
+		},
+		{
+			MethodName: "ListRelatedBlogs",
+			Handler:    _BlogService_ListRelatedBlogs_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -1090,3 +3865,273 @@ var _BlogService_serviceDesc = grpc.ServiceDesc{
 	},
 	Metadata: "blog/pb/blog.proto",
 }
+
+// BlogAdminServiceClient is the client API for BlogAdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
+type BlogAdminServiceClient interface {
+	// return ALREADY_EXISTS if the tenant exists
+	CreateTenant(ctx context.Context, in *CreateTenantRequest, opts ...grpc.CallOption) (*CreateTenantResponse, error)
+	// Drops all blogs of the tenant
+	// return NOT_FOUND if tenant not found
+	DeleteTenant(ctx context.Context, in *DeleteTenantRequest, opts ...grpc.CallOption) (*DeleteTenantResponse, error)
+	ListTenants(ctx context.Context, in *ListTenantsRequest, opts ...grpc.CallOption) (*ListTenantsResponse, error)
+	// Groups of blogs with nearly matching contents, in the tenant given
+	// by the request metadata
+	ListDuplicateClusters(ctx context.Context, in *ListDuplicateClustersRequest, opts ...grpc.CallOption) (*ListDuplicateClustersResponse, error)
+	// Blogs held for review or flagged by moderation, in the tenant given
+	// by the request metadata
+	ListModerationQueue(ctx context.Context, in *ListModerationQueueRequest, opts ...grpc.CallOption) (*ListModerationQueueResponse, error)
+	// Approving publishes the blog, rejecting hides it
+	// return NOT_FOUND if blog not found
+	ReviewBlog(ctx context.Context, in *ReviewBlogRequest, opts ...grpc.CallOption) (*ReviewBlogResponse, error)
+}
+
+type blogAdminServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBlogAdminServiceClient(cc grpc.ClientConnInterface) BlogAdminServiceClient {
+	return &blogAdminServiceClient{cc}
+}
+
+func (c *blogAdminServiceClient) CreateTenant(ctx context.Context, in *CreateTenantRequest, opts ...grpc.CallOption) (*CreateTenantResponse, error) {
+	out := new(CreateTenantResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogAdminService/CreateTenant", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogAdminServiceClient) DeleteTenant(ctx context.Context, in *DeleteTenantRequest, opts ...grpc.CallOption) (*DeleteTenantResponse, error) {
+	out := new(DeleteTenantResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogAdminService/DeleteTenant", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogAdminServiceClient) ListTenants(ctx context.Context, in *ListTenantsRequest, opts ...grpc.CallOption) (*ListTenantsResponse, error) {
+	out := new(ListTenantsResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogAdminService/ListTenants", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogAdminServiceClient) ListDuplicateClusters(ctx context.Context, in *ListDuplicateClustersRequest, opts ...grpc.CallOption) (*ListDuplicateClustersResponse, error) {
+	out := new(ListDuplicateClustersResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogAdminService/ListDuplicateClusters", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogAdminServiceClient) ListModerationQueue(ctx context.Context, in *ListModerationQueueRequest, opts ...grpc.CallOption) (*ListModerationQueueResponse, error) {
+	out := new(ListModerationQueueResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogAdminService/ListModerationQueue", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *blogAdminServiceClient) ReviewBlog(ctx context.Context, in *ReviewBlogRequest, opts ...grpc.CallOption) (*ReviewBlogResponse, error) {
+	out := new(ReviewBlogResponse)
+	err := c.cc.Invoke(ctx, "/blog.BlogAdminService/ReviewBlog", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// BlogAdminServiceServer is the server API for BlogAdminService service.
+type BlogAdminServiceServer interface {
+	// return ALREADY_EXISTS if the tenant exists
+	CreateTenant(context.Context, *CreateTenantRequest) (*CreateTenantResponse, error)
+	// Drops all blogs of the tenant
+	// return NOT_FOUND if tenant not found
+	DeleteTenant(context.Context, *DeleteTenantRequest) (*DeleteTenantResponse, error)
+	ListTenants(context.Context, *ListTenantsRequest) (*ListTenantsResponse, error)
+	// Groups of blogs with nearly matching contents, in the tenant given
+	// by the request metadata
+	ListDuplicateClusters(context.Context, *ListDuplicateClustersRequest) (*ListDuplicateClustersResponse, error)
+	// Blogs held for review or flagged by moderation, in the tenant given
+	// by the request metadata
+	ListModerationQueue(context.Context, *ListModerationQueueRequest) (*ListModerationQueueResponse, error)
+	// Approving publishes the blog, rejecting hides it
+	// return NOT_FOUND if blog not found
+	ReviewBlog(context.Context, *ReviewBlogRequest) (*ReviewBlogResponse, error)
+}
+
+// UnimplementedBlogAdminServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedBlogAdminServiceServer struct {
+}
+
+func (*UnimplementedBlogAdminServiceServer) CreateTenant(context.Context, *CreateTenantRequest) (*CreateTenantResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateTenant not implemented")
+}
+func (*UnimplementedBlogAdminServiceServer) DeleteTenant(context.Context, *DeleteTenantRequest) (*DeleteTenantResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTenant not implemented")
+}
+func (*UnimplementedBlogAdminServiceServer) ListTenants(context.Context, *ListTenantsRequest) (*ListTenantsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTenants not implemented")
+}
+func (*UnimplementedBlogAdminServiceServer) ListDuplicateClusters(context.Context, *ListDuplicateClustersRequest) (*ListDuplicateClustersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListDuplicateClusters not implemented")
+}
+func (*UnimplementedBlogAdminServiceServer) ListModerationQueue(context.Context, *ListModerationQueueRequest) (*ListModerationQueueResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListModerationQueue not implemented")
+}
+func (*UnimplementedBlogAdminServiceServer) ReviewBlog(context.Context, *ReviewBlogRequest) (*ReviewBlogResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReviewBlog not implemented")
+}
+
+func RegisterBlogAdminServiceServer(s *grpc.Server, srv BlogAdminServiceServer) {
+	s.RegisterService(&_BlogAdminService_serviceDesc, srv)
+}
+
+func _BlogAdminService_CreateTenant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateTenantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogAdminServiceServer).CreateTenant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogAdminService/CreateTenant",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogAdminServiceServer).CreateTenant(ctx, req.(*CreateTenantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogAdminService_DeleteTenant_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTenantRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogAdminServiceServer).DeleteTenant(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogAdminService/DeleteTenant",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogAdminServiceServer).DeleteTenant(ctx, req.(*DeleteTenantRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogAdminService_ListTenants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTenantsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogAdminServiceServer).ListTenants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogAdminService/ListTenants",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogAdminServiceServer).ListTenants(ctx, req.(*ListTenantsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogAdminService_ListDuplicateClusters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListDuplicateClustersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogAdminServiceServer).ListDuplicateClusters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogAdminService/ListDuplicateClusters",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogAdminServiceServer).ListDuplicateClusters(ctx, req.(*ListDuplicateClustersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogAdminService_ListModerationQueue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListModerationQueueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogAdminServiceServer).ListModerationQueue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogAdminService/ListModerationQueue",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogAdminServiceServer).ListModerationQueue(ctx, req.(*ListModerationQueueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BlogAdminService_ReviewBlog_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReviewBlogRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BlogAdminServiceServer).ReviewBlog(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/blog.BlogAdminService/ReviewBlog",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BlogAdminServiceServer).ReviewBlog(ctx, req.(*ReviewBlogRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var _BlogAdminService_serviceDesc = grpc.ServiceDesc{
+	ServiceName: "blog.BlogAdminService",
+	HandlerType: (*BlogAdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateTenant",
+			Handler:    _BlogAdminService_CreateTenant_Handler,
+		},
+		{
+			MethodName: "DeleteTenant",
+			Handler:    _BlogAdminService_DeleteTenant_Handler,
+		},
+		{
+			MethodName: "ListTenants",
+			Handler:    _BlogAdminService_ListTenants_Handler,
+		},
+		{
+			MethodName: "ListDuplicateClusters",
+			Handler:    _BlogAdminService_ListDuplicateClusters_Handler,
+		},
+		{
+			MethodName: "ListModerationQueue",
+			Handler:    _BlogAdminService_ListModerationQueue_Handler,
+		},
+		{
+			MethodName: "ReviewBlog",
+			Handler:    _BlogAdminService_ReviewBlog_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "blog/pb/blog.proto",
+}
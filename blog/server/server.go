@@ -2,238 +2,87 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"flag"
 	"log"
-	"net"
-	"os"
-	"os/signal"
+	"log/slog"
+	"time"
 
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/blogservice"
 	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"github.com/andreasatle/Udemy/grpc-go-course/bootstrap"
+	"github.com/andreasatle/Udemy/grpc-go-course/interceptor"
 	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
-var collection *mongo.Collection
+var serverFlags = bootstrap.RegisterFlags("BLOG", bootstrap.Config{
+	Address:    "0.0.0.0:50051",
+	Reflection: true,
+})
 
-type server struct{}
-type blogItem struct {
-	Id       primitive.ObjectID `bson:"_id,omitempty"`
-	AuthorId string             `bson:"author_id"`
-	Content  string             `bson:"content"`
-	Title    string             `bson:"title"`
-}
-
-func (*server) CreateBlog(ctx context.Context, req *pb.CreateBlogRequest) (*pb.CreateBlogResponse, error) {
-	fmt.Printf("CreateBlog called on Server: %v\n", req)
-	blog := req.GetBlog()
-
-	data := &blogItem{
-		AuthorId: blog.GetAuthorId(),
-		Title:    blog.GetTitle(),
-		Content:  blog.GetContent(),
-	}
+func main() {
+	// If we crash the code, we get the file and line-number
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	flag.Parse()
 
-	res, err := collection.InsertOne(context.Background(), data)
+	config, err := serverFlags.Config()
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("Internal error: %v", err))
+		log.Fatalf("Failed to read the configuration: %v\n", err)
 	}
 
-	oid, ok := res.InsertedID.(primitive.ObjectID)
-	if !ok {
-		return nil, status.Errorf(codes.Internal, fmt.Sprintf("Cannot convert to OID: %v", err))
-	}
-
-	return &pb.CreateBlogResponse{
-		Blog: &pb.Blog{
-			Id:       oid.Hex(),
-			AuthorId: blog.GetAuthorId(),
-			Title:    blog.GetTitle(),
-			Content:  blog.GetContent(),
-		},
-	}, nil
-}
-
-func (*server) ReadBlog(ctx context.Context, req *pb.ReadBlogRequest) (*pb.ReadBlogResponse, error) {
-	fmt.Printf("ReadBlog called on Server: %v\n", req)
-
-	blogID := req.GetBlogId()
-	oid, err := primitive.ObjectIDFromHex(blogID)
+	// Connect to MongoDB
+	client, err := blogservice.Connect(context.TODO())
 	if err != nil {
-		return nil, status.Errorf(
-			codes.InvalidArgument,
-			fmt.Sprintf("Cannot parse ID: %v\n", err))
-	}
-
-	// Create an empty struct
-	data := &blogItem{}
-	res := collection.FindOne(context.Background(), bson.M{"_id": oid})
-	if err := res.Decode(data); err != nil {
-		return nil, status.Errorf(
-			codes.NotFound,
-			fmt.Sprintf("Cannot find blog with specified ID: %v", err))
+		log.Fatal(err)
 	}
+	slog.Info("Connected to MongoDB")
 
-	return &pb.ReadBlogResponse{Blog: dataToPb(data)}, nil
-}
-
-func (*server) UpdateBlog(ctx context.Context, req *pb.UpdateBlogRequest) (*pb.UpdateBlogResponse, error) {
-	fmt.Printf("UpdateBlog called on Server: %v\n", req)
-
-	blog := req.GetBlog()
-	oid, err := primitive.ObjectIDFromHex(blog.GetId())
+	blogs, err := blogservice.New(context.TODO(), client)
 	if err != nil {
-		return nil, status.Errorf(
-			codes.InvalidArgument,
-			fmt.Sprintf("Cannot parse ID: %v\n", err))
-	}
-
-	// Create an empty struct
-	data := &blogItem{}
-	filter := bson.M{"_id": oid}
-	findRes := collection.FindOne(context.Background(), filter)
-	if err := findRes.Decode(data); err != nil {
-		return nil, status.Errorf(
-			codes.NotFound,
-			fmt.Sprintf("Cannot find blog with specified ID: %v", err))
-	}
-
-	// Set the data to be updated
-	data.AuthorId = blog.GetAuthorId()
-	data.Content = blog.GetContent()
-	data.Title = blog.GetTitle()
-
-	update := bson.M{"$set": data}
-	_, updateErr := collection.UpdateOne(context.Background(), filter, update)
-	if updateErr != nil {
-		return nil, status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("Cannot update object in MongoDB: %v", updateErr))
+		log.Fatalln(err)
 	}
-	return &pb.UpdateBlogResponse{Blog: dataToPb(data)}, nil
-}
-
-func (*server) DeleteBlog(ctx context.Context, req *pb.DeleteBlogRequest) (*pb.DeleteBlogResponse, error) {
-	fmt.Printf("DeleteBlog called on Server: %v\n", req)
 
-	blogId := req.GetBlogId()
-	oid, err := primitive.ObjectIDFromHex(blogId)
+	lis, err := config.Listen()
 	if err != nil {
-		return nil, status.Errorf(
-			codes.InvalidArgument,
-			fmt.Sprintf("Cannot parse ID: %v\n", err))
-	}
-	filter := bson.M{"_id": oid}
-	res, err := collection.DeleteOne(context.Background(), filter)
-	if err != nil {
-		return nil, status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("Cannot delete object in MongoDB: %v", err))
-	}
-	if res.DeletedCount == 0 {
-		return nil, status.Errorf(
-			codes.NotFound,
-			fmt.Sprintf("Cannot find blog in MongoDG: %v\n", err))
+		log.Fatalf("Failed to listen: %v\n", err)
 	}
-	return &pb.DeleteBlogResponse{BlogId: req.GetBlogId()}, nil
-}
-
-func (*server) ListBlog(req *pb.ListBlogRequest, stream pb.BlogService_ListBlogServer) error {
-	fmt.Printf("ListBlog called on Server: %v\n", req)
-
-	ctx := context.Background()
 
-	cur, err := collection.Find(ctx, primitive.D{{}})
-	fmt.Println("cur: ", cur)
+	// The expensive calls get tighter limits than the default ones
+	limits := interceptor.DefaultRateLimitConfig
+	limits.PerMethod = blogservice.MethodLimits
+	limiter := interceptor.NewRateLimiter(limits)
+	s, err := config.NewServer(
+		grpc.ChainUnaryInterceptor(limiter.UnaryServerInterceptor(), blogservice.UnaryAdminAuthInterceptor, blogservice.UnaryTimeoutInterceptor),
+		grpc.ChainStreamInterceptor(limiter.StreamServerInterceptor(), blogservice.StreamAdminAuthInterceptor, blogservice.StreamTimeoutInterceptor),
+	)
 	if err != nil {
-		return status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("Unknown internal error: %v\n", err))
+		log.Fatalf("Failed to create the server: %v\n", err)
 	}
-	defer cur.Close(ctx)
+	blogs.Register(s.Server)
+	s.RegisterGateway(pb.RegisterBlogServiceHandler)
+	s.SetServing()
 
-	for cur.Next(ctx) {
-		data := &blogItem{}
-		err := cur.Decode(data)
-		if err != nil {
-			return status.Errorf(
-				codes.Internal,
-				fmt.Sprintf("Error decoding data from MongoDG: %v", err))
-		}
-		stream.Send(&pb.ListBlogResponse{Blog: dataToPb(data)})
-	}
-	if err := cur.Err(); err != nil {
-		fmt.Println("Internal error")
-		return status.Errorf(
-			codes.Internal,
-			fmt.Sprintf("Unknown internal error: %v", err))
-	}
-	return nil
-}
+	ctx, cancel := context.WithCancel(context.Background())
+	go blogs.RunBackups(ctx)
+	go blogs.MonitorHealth(ctx, s.Health)
+	go blogs.RunViewFlushes(ctx)
 
-func dataToPb(data *blogItem) *pb.Blog {
-	return &pb.Blog{
-		Id:       data.Id.Hex(),
-		AuthorId: data.AuthorId,
-		Content:  data.Content,
-		Title:    data.Title,
+	slog.Info("Starting blog server", "address", config.Address)
+	if err := s.Run(lis); err != nil {
+		log.Fatalf("Failed to serve: %v\n", err)
 	}
+	cancel()
+	blogs.FlushViews(context.Background())
+	disconnect(client)
+	slog.Info("End of program")
 }
 
-func main() {
-	// If we crash the code, we get the file and line-number
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
-
-	// Set client options
-	clientOptions := options.Client().ApplyURI("mongodb://localhost:27017")
-
-	// Connect to MongoDB
-	client, err := mongo.Connect(context.TODO(), clientOptions)
-	if err != nil {
-		log.Fatal(err)
+// disconnect closes the MongoDB client, once the server is stopped
+func disconnect(client *mongo.Client) {
+	slog.Info("Disconnecting from MongoDB")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Disconnect(ctx); err != nil {
+		slog.Error("Failed to disconnect from MongoDB", "error", err)
 	}
-
-	collection = client.Database("blogDB").Collection("blog")
-	lis, err := net.Listen("tcp", "0.0.0.0:50051")
-	if err != nil {
-		log.Fatalf("Failed to listen: %v\n", err)
-	}
-
-	// Check the connection
-	err = client.Ping(context.TODO(), nil)
-
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	fmt.Println("Connected to MongoDB!")
-
-	fmt.Println("Blog Service Started!")
-	opts := []grpc.ServerOption{}
-	s := grpc.NewServer(opts...)
-	pb.RegisterBlogServiceServer(s, &server{})
-
-	go func() {
-		fmt.Println("Starting Server...")
-		if err := s.Serve(lis); err != nil {
-			log.Fatalf("Failed to serve: %v\n", err)
-		}
-	}()
-
-	// Wait for control-C to exit
-	ch := make(chan os.Signal, 1)
-	signal.Notify(ch, os.Interrupt)
-
-	// Block until a signal is received
-	<-ch
-	fmt.Println("Stopping the server")
-	s.Stop()
-	fmt.Println("Closing the listener")
-	lis.Close()
-	client.Disconnect(context.TODO())
-	fmt.Println("End of program")
 }
@@ -0,0 +1,587 @@
+// Package bootstrap builds the gRPC servers of the course from command-line
+// flags, environment variables and an optional YAML config file.
+//
+// Settings are applied in order of precedence, lowest first: the defaults
+// of the server, the config file, the environment and the command line.
+package bootstrap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/interceptor"
+	"github.com/andreasatle/Udemy/grpc-go-course/openapi"
+	"github.com/andreasatle/Udemy/grpc-go-course/telemetry"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the settings shared by all servers.
+type Config struct {
+	Address     string          `yaml:"listen"`
+	HTTPAddress string          `yaml:"http_listen"` // Serves /metrics, the JSON gateway and other HTTP endpoints, empty disables them
+	TLS         TLSConfig       `yaml:"tls"`
+	GRPCWeb     GRPCWebConfig   `yaml:"grpc_web"`
+	Reflection  bool            `yaml:"reflection"`
+	MaxRecvMsg  int             `yaml:"max_recv_msg_size"` // Bytes, 0 keeps the gRPC default
+	MaxSendMsg  int             `yaml:"max_send_msg_size"` // Bytes, 0 keeps the gRPC default
+	Keepalive   KeepaliveConfig `yaml:"keepalive"`
+	// DrainTimeout is how long in-flight calls may run on shutdown
+	DrainTimeout time.Duration    `yaml:"drain_timeout"`
+	Log          LogConfig        `yaml:"log"`
+	Tracing      telemetry.Config `yaml:"tracing"`
+}
+
+// LogConfig configures the JSON logs of the server.
+type LogConfig struct {
+	// Level is debug, info, warn or error. Requests are only logged at debug level.
+	Level string `yaml:"level"`
+	// Redact are the proto names of the request fields left out of the logs
+	Redact []string `yaml:"redact"`
+}
+
+// streamBatchSize is the number of streamed messages traced by one span.
+const streamBatchSize = 100
+
+// DefaultDrainTimeout is used when the defaults of a server have no drain timeout.
+const DefaultDrainTimeout = 30 * time.Second
+
+// DefaultRedact are the fields left out of the logs, unless the defaults
+// of a server say otherwise.
+var DefaultRedact = []string{"content"}
+
+// TLSConfig enables TLS when both files are set. The HTTP endpoints are
+// then served with TLS too.
+type TLSConfig struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CAFile is the CA the gateway verifies the server certificate with,
+	// empty trusts the server certificate itself
+	CAFile string `yaml:"ca_file"`
+}
+
+// GRPCWebConfig serves the services to browsers with gRPC-Web on the HTTP
+// endpoints, next to the gRPC listener.
+type GRPCWebConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// AllowedOrigins are the origins of the web apps allowed to call the
+	// services, "*" allows any origin. Other cross-origin calls are denied.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+}
+
+// KeepaliveConfig sets the keepalive parameters, zero values keep the gRPC defaults.
+type KeepaliveConfig struct {
+	// Time is how long a connection may be idle before the server pings the client
+	Time time.Duration `yaml:"time"`
+	// Timeout is how long the server waits for the ping to be acknowledged
+	Timeout time.Duration `yaml:"timeout"`
+	// MinTime is the shortest time between pings the server accepts from a client
+	MinTime time.Duration `yaml:"min_time"`
+}
+
+// Flags are the command-line flags of a server, see RegisterFlags.
+type Flags struct {
+	envPrefix  string
+	defaults   Config
+	configFile *string
+	flags      *flag.FlagSet
+}
+
+// RegisterFlags registers the flags of the shared settings on the default
+// command line. The environment variables of the settings are named after
+// the flags, with the prefix, e.g. BLOG_LISTEN for -listen with prefix BLOG.
+// Call Config after flag.Parse to get the settings.
+func RegisterFlags(envPrefix string, defaults Config) *Flags {
+	if defaults.DrainTimeout == 0 {
+		defaults.DrainTimeout = DefaultDrainTimeout
+	}
+	if defaults.Log.Level == "" {
+		defaults.Log.Level = "info"
+	}
+	if defaults.Log.Redact == nil {
+		defaults.Log.Redact = DefaultRedact
+	}
+	if defaults.Tracing.ServiceName == "" {
+		defaults.Tracing.ServiceName = strings.ToLower(envPrefix) + "-server"
+	}
+	if defaults.Tracing.Exporter == "" {
+		defaults.Tracing.Exporter = telemetry.ExporterNone
+	}
+	f := &Flags{
+		envPrefix: envPrefix,
+		defaults:  defaults,
+		flags:     flag.CommandLine,
+	}
+	f.configFile = flag.String("config", "", fmt.Sprintf("YAML config file, also set by %s", f.envName("config")))
+	cmdline := defaults
+	bindFlags(flag.CommandLine, &cmdline)
+	return f
+}
+
+func bindFlags(fs *flag.FlagSet, c *Config) {
+	fs.StringVar(&c.Address, "listen", c.Address, "Address to listen on")
+	fs.StringVar(&c.HTTPAddress, "http-listen", c.HTTPAddress, "Address of the HTTP endpoints, like /metrics and the JSON gateway, empty disables them")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert", c.TLS.CertFile, "TLS certificate file, TLS is disabled without it")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key", c.TLS.KeyFile, "TLS private key file")
+	fs.StringVar(&c.TLS.CAFile, "tls-ca", c.TLS.CAFile, "CA of the TLS certificate, which the gateway verifies the server with, defaults to the certificate itself")
+	fs.BoolVar(&c.GRPCWeb.Enabled, "grpc-web", c.GRPCWeb.Enabled, "Serve gRPC-Web on the HTTP endpoints")
+	fs.Var((*stringList)(&c.GRPCWeb.AllowedOrigins), "grpc-web-origins", "Comma separated origins allowed to call gRPC-Web, * allows any origin")
+	fs.BoolVar(&c.Reflection, "reflection", c.Reflection, "Register the server reflection service")
+	fs.IntVar(&c.MaxRecvMsg, "max-recv-msg-size", c.MaxRecvMsg, "Largest message received in bytes, 0 for the gRPC default")
+	fs.IntVar(&c.MaxSendMsg, "max-send-msg-size", c.MaxSendMsg, "Largest message sent in bytes, 0 for the gRPC default")
+	fs.DurationVar(&c.Keepalive.Time, "keepalive-time", c.Keepalive.Time, "Idle time before the server pings a client, 0 for the gRPC default")
+	fs.DurationVar(&c.Keepalive.Timeout, "keepalive-timeout", c.Keepalive.Timeout, "Time to wait for a keepalive ping to be acknowledged, 0 for the gRPC default")
+	fs.DurationVar(&c.Keepalive.MinTime, "keepalive-min-time", c.Keepalive.MinTime, "Shortest time between client pings, 0 for the gRPC default")
+	fs.DurationVar(&c.DrainTimeout, "drain-timeout", c.DrainTimeout, "How long in-flight calls may run on shutdown before they are canceled")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "Log level: debug, info, warn or error")
+	fs.Var((*stringList)(&c.Log.Redact), "log-redact", "Comma separated request fields left out of the logs")
+	fs.StringVar(&c.Tracing.Exporter, "trace-exporter", c.Tracing.Exporter, "Exporter of the traces: none, stderr or file")
+	fs.StringVar(&c.Tracing.File, "trace-file", c.Tracing.File, "Output of the file trace exporter")
+}
+
+// stringList is a comma separated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = nil
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+func (f *Flags) envName(name string) string {
+	return f.envPrefix + "_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Config merges the defaults, the config file, the environment and the
+// command line into the settings of the server. The logger of the settings
+// becomes the default logger.
+func (f *Flags) Config() (*Config, error) {
+	config := f.defaults
+
+	path := *f.configFile
+	if env, ok := os.LookupEnv(f.envName("config")); ok && !f.isSet("config") {
+		path = env
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+		}
+	}
+
+	// Replay the environment and the command line on top of the config file
+	fs := flag.NewFlagSet(f.flags.Name(), flag.ContinueOnError)
+	bindFlags(fs, &config)
+	var err error
+	fs.VisitAll(func(fl *flag.Flag) {
+		if env, ok := os.LookupEnv(f.envName(fl.Name)); ok && err == nil {
+			if setErr := fs.Set(fl.Name, env); setErr != nil {
+				err = fmt.Errorf("invalid %s: %v", f.envName(fl.Name), setErr)
+			}
+		}
+	})
+	f.flags.Visit(func(fl *flag.Flag) {
+		if fs.Lookup(fl.Name) != nil && err == nil {
+			err = fs.Set(fl.Name, fl.Value.String())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	logger, err := config.Log.newLogger()
+	if err != nil {
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	return &config, nil
+}
+
+func (f *Flags) isSet(name string) bool {
+	set := false
+	f.flags.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+// Listen opens the listener of the server.
+func (c *Config) Listen() (net.Listener, error) {
+	return net.Listen("tcp", c.Address)
+}
+
+// Server is a gRPC server with the standard health service, and an HTTP
+// server for the endpoints next to gRPC, like /metrics.
+type Server struct {
+	*grpc.Server
+	Health *health.Server
+	// HTTP holds the HTTP endpoints, served when an HTTP address is set
+	HTTP *http.ServeMux
+
+	httpAddress  string
+	tls          TLSConfig
+	drainTimeout time.Duration
+	stopTracing  func(context.Context) error
+	gateways     []GatewayHandler
+}
+
+// GatewayHandler registers the HTTP/JSON routes of a service, like the
+// generated Register<Service>Handler functions.
+type GatewayHandler func(ctx context.Context, mux *runtime.ServeMux, conn *grpc.ClientConn) error
+
+// gatewayPrefix is the path of the HTTP endpoints served by the gateway.
+const gatewayPrefix = "/v1/"
+
+// NewServer creates a server with the settings of c, followed by opts.
+// The health service, and the reflection service when enabled, are
+// registered here, the other services are registered by the caller.
+// Every call is traced, logged to the default logger and recorded in the
+// default Prometheus registry, before the interceptors of opts run. Panics
+// of the handlers and of the interceptors of opts are recovered.
+func (c *Config) NewServer(opts ...grpc.ServerOption) (*Server, error) {
+	calls := interceptor.NewCallLogger(slog.Default(), c.Log.Redact)
+	metrics := interceptor.NewMetrics(prometheus.DefaultRegisterer)
+	recovery := interceptor.NewRecovery(prometheus.DefaultRegisterer)
+
+	serverOpts, err := c.serverOptions()
+	if err != nil {
+		return nil, err
+	}
+	stopTracing, err := telemetry.Setup(c.Tracing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up tracing: %v", err)
+	}
+	serverOpts = append(serverOpts,
+		grpc.StatsHandler(otelgrpc.NewServerHandler(otelgrpc.WithMessageEvents(otelgrpc.ReceivedEvents, otelgrpc.SentEvents))),
+		grpc.ChainUnaryInterceptor(
+			calls.UnaryServerInterceptor(),
+			metrics.UnaryServerInterceptor(),
+			recovery.UnaryServerInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			calls.StreamServerInterceptor(),
+			metrics.StreamServerInterceptor(),
+			interceptor.TraceStreamBatches(streamBatchSize),
+			recovery.StreamServerInterceptor(),
+		),
+	)
+	s := &Server{
+		Server: grpc.NewServer(append(serverOpts, opts...)...),
+		Health: health.NewServer(),
+		HTTP:   http.NewServeMux(),
+
+		httpAddress:  c.HTTPAddress,
+		tls:          c.TLS,
+		drainTimeout: c.DrainTimeout,
+		stopTracing:  stopTracing,
+	}
+	s.HTTP.Handle("/metrics", promhttp.Handler())
+	if c.GRPCWeb.Enabled {
+		s.HTTP.Handle("/", s.grpcWebHandler(c.GRPCWeb.AllowedOrigins))
+	}
+	healthpb.RegisterHealthServer(s.Server, s.Health)
+	if c.Reflection {
+		reflection.Register(s.Server)
+	}
+	return s, nil
+}
+
+// SetServing reports all services registered so far as serving.
+func (s *Server) SetServing() {
+	for name := range s.GetServiceInfo() {
+		s.Health.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	}
+}
+
+// grpcWebHandler serves the gRPC-Web calls and their CORS preflight
+// requests, and answers other requests with 404.
+func (s *Server) grpcWebHandler(allowedOrigins []string) http.Handler {
+	origins := make(map[string]bool)
+	for _, origin := range allowedOrigins {
+		origins[origin] = true
+	}
+	wrapped := grpcweb.WrapServer(s.Server, grpcweb.WithOriginFunc(func(origin string) bool {
+		return origins["*"] || origins[origin]
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrapped.IsGrpcWebRequest(r) || wrapped.IsAcceptableGrpcCorsRequest(r) {
+			wrapped.ServeHTTP(w, r)
+			return
+		}
+		http.NotFound(w, r)
+	})
+}
+
+// RegisterGateway serves the HTTP/JSON routes of services under /v1/ on
+// the HTTP endpoints, and their OpenAPI document at /openapi.json. The
+// gateway calls the services through the gRPC listener, so that the calls
+// go through the same interceptors. Results of server streaming calls are
+// sent as newline-delimited JSON.
+func (s *Server) RegisterGateway(handlers ...GatewayHandler) {
+	s.gateways = append(s.gateways, handlers...)
+}
+
+// serveGateway registers the gateway on the HTTP endpoints, connected to
+// the gRPC listener at addr. The returned connection must be closed after
+// the HTTP server.
+func (s *Server) serveGateway(addr net.Addr) (*grpc.ClientConn, error) {
+	creds := grpc.WithInsecure()
+	if s.tls.CertFile != "" {
+		config, err := s.tls.gatewayConfig()
+		if err != nil {
+			return nil, err
+		}
+		creds = grpc.WithTransportCredentials(credentials.NewTLS(config))
+	}
+	conn, err := grpc.Dial(loopbackAddress(addr), creds, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
+	if err != nil {
+		return nil, err
+	}
+
+	// The gateway identifies the HTTP client to the rate limiter, in
+	// metadata that HTTP clients cannot set themselves
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			name, ok := runtime.DefaultHeaderMatcher(key)
+			if ok && interceptor.IsGatewayMetadata(name) {
+				return "", false
+			}
+			return name, ok
+		}),
+		runtime.WithMetadata(func(ctx context.Context, r *http.Request) metadata.MD {
+			return interceptor.GatewayMetadata(r.RemoteAddr)
+		}),
+	)
+	for _, register := range s.gateways {
+		if err := register(context.Background(), mux, conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	s.HTTP.Handle(gatewayPrefix, mux)
+
+	var services []string
+	for name := range s.GetServiceInfo() {
+		services = append(services, name)
+	}
+	doc, err := openapi.JSON(services...)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("invalid OpenAPI document: %v", err)
+	}
+	s.HTTP.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	})
+	return conn, nil
+}
+
+// gatewayConfig is the TLS config the gateway dials its own listener with.
+// The listener is dialed at a loopback address, which the certificate need
+// not name, so the certificate chain is verified against the CA file, or
+// the certificate itself, but not the host name.
+func (c *TLSConfig) gatewayConfig() (*tls.Config, error) {
+	caFile := c.CAFile
+	if caFile == "" {
+		caFile = c.CertFile
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in %s", caFile)
+	}
+	return &tls.Config{
+		// The default verification would check the host name as well, the
+		// chain is verified by VerifyConnection instead
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("the server sent no certificate")
+			}
+			opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(opts)
+			return err
+		},
+	}, nil
+}
+
+// loopbackAddress replaces the unspecified host of a listener, like
+// 0.0.0.0, with localhost.
+func loopbackAddress(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || !tcp.IP.IsUnspecified() {
+		return addr.String()
+	}
+	return net.JoinHostPort("localhost", strconv.Itoa(tcp.Port))
+}
+
+func (c *LogConfig) newLogger() (*slog.Logger, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q", c.Level)
+	}
+	return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level})), nil
+}
+
+func (c *Config) serverOptions() ([]grpc.ServerOption, error) {
+	opts := []grpc.ServerOption{}
+
+	if c.TLS.CertFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(c.TLS.CertFile, c.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed loading certificates: %v", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	if c.MaxRecvMsg > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(c.MaxRecvMsg))
+	}
+	if c.MaxSendMsg > 0 {
+		opts = append(opts, grpc.MaxSendMsgSize(c.MaxSendMsg))
+	}
+	if c.Keepalive.Time > 0 || c.Keepalive.Timeout > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    c.Keepalive.Time,
+			Timeout: c.Keepalive.Timeout,
+		}))
+	}
+	if c.Keepalive.MinTime > 0 {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime: c.Keepalive.MinTime,
+		}))
+	}
+	return opts, nil
+}
+
+// Run serves on lis, and the HTTP endpoints and the gateway if enabled,
+// until SIGINT or SIGTERM, and then shuts down gracefully. The health
+// service reports NOT_SERVING, so that load balancers stop sending new
+// calls, and in-flight calls get the drain timeout to finish. Calls still
+// running after that, or after a second signal, are canceled.
+func (s *Server) Run(lis net.Listener) error {
+	var httpServer *http.Server
+	if s.httpAddress != "" {
+		httpServer = &http.Server{Handler: s.HTTP}
+		if s.tls.CertFile != "" {
+			cert, err := tls.LoadX509KeyPair(s.tls.CertFile, s.tls.KeyFile)
+			if err != nil {
+				return fmt.Errorf("failed loading certificates: %v", err)
+			}
+			httpServer.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		}
+		httpLis, err := net.Listen("tcp", s.httpAddress)
+		if err != nil {
+			return err
+		}
+		if len(s.gateways) > 0 {
+			conn, err := s.serveGateway(lis.Addr())
+			if err != nil {
+				httpLis.Close()
+				return fmt.Errorf("failed to start the gateway: %v", err)
+			}
+			defer conn.Close()
+		}
+		go func() {
+			var err error
+			if httpServer.TLSConfig != nil {
+				err = httpServer.ServeTLS(httpLis, "", "")
+			} else {
+				err = httpServer.Serve(httpLis)
+			}
+			if err != http.ErrServerClosed {
+				slog.Error("HTTP server failed", "error", err)
+			}
+		}()
+		slog.Info("Serving HTTP endpoints", "address", s.httpAddress, "tls", httpServer.TLSConfig != nil)
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- s.Serve(lis)
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	select {
+	case err := <-errc:
+		return err
+	case received := <-sig:
+		slog.Info("Draining connections", "signal", received.String(), "timeout", s.drainTimeout.String())
+	}
+
+	s.Health.Shutdown()
+	ctx, cancel := context.WithTimeout(context.Background(), s.drainTimeout)
+	defer cancel()
+	if httpServer != nil {
+		go httpServer.Shutdown(ctx)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		slog.Info("All connections drained")
+	case <-ctx.Done():
+		slog.Warn("Drain timeout exceeded, canceling the remaining calls")
+		s.Stop()
+	case <-sig:
+		slog.Warn("Received second signal, canceling the remaining calls")
+		s.Stop()
+	}
+	<-stopped
+	if httpServer != nil {
+		httpServer.Close()
+	}
+	if err := s.stopTracing(context.Background()); err != nil {
+		slog.Error("Failed to flush the traces", "error", err)
+	}
+	return <-errc
+}
@@ -0,0 +1,102 @@
+package bootstrap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeCertificate writes a self-signed certificate for CN=localhost,
+// without subject alternative names like the certificates in ssl/, and
+// returns the paths of the certificate and key files.
+func writeCertificate(t *testing.T, name string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, name+".crt")
+	keyFile := filepath.Join(dir, name+".pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func TestGatewayConfigVerifiesServer(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, "server")
+	otherFile, _ := writeCertificate(t, "other")
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		trusted bool
+	}{
+		{"server certificate", TLSConfig{CertFile: certFile, KeyFile: keyFile}, true},
+		{"CA file", TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: certFile}, true},
+		{"other CA", TLSConfig{CertFile: certFile, KeyFile: keyFile, CAFile: otherFile}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := tt.config.gatewayConfig()
+			if err != nil {
+				t.Fatalf("gatewayConfig() = %v", err)
+			}
+			conn, err := tls.Dial("tcp", lis.Addr().String(), config)
+			if err == nil {
+				conn.Close()
+			}
+			if (err == nil) != tt.trusted {
+				t.Errorf("Dial() = %v, want trusted %v", err, tt.trusted)
+			}
+		})
+	}
+}
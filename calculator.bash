@@ -1,2 +1,3 @@
-#/bin/bash
-protoc calculator/calculatorpb/calculator.proto --go_out=plugins=grpc:.
+#!/bin/bash
+# Regenerates the code of all protos, see generate.sh
+bash "$(dirname "$0")/generate.sh"
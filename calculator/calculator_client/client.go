@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/andreasatle/Udemy/grpc-go-course/calculator/calculatorpb"
+	"github.com/andreasatle/Udemy/grpc-go-course/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -16,7 +18,14 @@ import (
 func main() {
 	fmt.Println("Hello world, from Calculator client!")
 
-	cc, err := grpc.Dial("localhost:50051", grpc.WithInsecure())
+	// Trace the calls when TRACE_EXPORTER is set, see the telemetry package
+	stopTracing, err := telemetry.Setup(telemetry.ConfigFromEnv("calculator-client"))
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v\n", err)
+	}
+	defer stopTracing(context.Background())
+
+	cc, err := grpc.Dial("localhost:50051", grpc.WithInsecure(), grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
 	if err != nil {
 		log.Fatalf("Client could not connect to server: %v", err)
 	}
@@ -0,0 +1,108 @@
+// Package calculatorservice implements CalculatorService.
+package calculatorservice
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+
+	pb "github.com/andreasatle/Udemy/grpc-go-course/calculator/calculatorpb"
+	"github.com/andreasatle/Udemy/grpc-go-course/streamerr"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements CalculatorService.
+type Server struct{}
+
+func (*Server) Sum(ctx context.Context, req *pb.SumRequest) (*pb.SumResponse, error) {
+	firstNumber := req.GetFirstNumber()
+	secondNumber := req.GetSecondNumber()
+	result := firstNumber + secondNumber
+	res := &pb.SumResponse{
+		SumResult: result,
+	}
+	return res, nil
+}
+
+func (*Server) Prime(req *pb.PrimeRequest, stream pb.CalculatorService_PrimeServer) error {
+	for divisor, number := int64(2), req.GetNumber(); number > 1 && divisor <= number; {
+		if number%divisor == 0 {
+			number /= divisor
+			res := &pb.PrimeResponse{
+				PrimeResult: divisor,
+			}
+			if err := stream.Send(res); err != nil {
+				return streamerr.Status(stream.Context(), "sending to the client", err)
+			}
+			//time.Sleep(1000 * time.Millisecond)
+		} else {
+			divisor++
+		}
+	}
+	return nil
+}
+
+func (*Server) Average(stream pb.CalculatorService_AverageServer) error {
+	sum := int64(0)
+	nTerms := int64(0)
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			average := float64(sum) / float64(nTerms)
+			return stream.SendAndClose(&pb.AverageResponse{
+				Average: average,
+			})
+		}
+		if err != nil {
+			return streamerr.Status(stream.Context(), "reading the client stream", err)
+		}
+
+		sum += req.GetNumber()
+		nTerms++
+	}
+}
+
+func (*Server) Max(stream pb.CalculatorService_MaxServer) error {
+	maxNum := int64(math.MinInt64)
+
+	for {
+		req, recvErr := stream.Recv()
+		if recvErr == io.EOF {
+			return nil
+		}
+		if recvErr != nil {
+			return streamerr.Status(stream.Context(), "reading the client stream", recvErr)
+		}
+
+		// Check if num is maximum so far
+		num := req.GetNumber()
+		if num <= maxNum {
+			continue
+		}
+		maxNum = num
+
+		sendErr := stream.Send(&pb.MaxResponse{
+			Max: maxNum,
+		})
+		if sendErr != nil {
+			return streamerr.Status(stream.Context(), "sending to the client", sendErr)
+		}
+
+	}
+}
+
+func (*Server) SquareRoot(ctx context.Context, req *pb.SquareRootRequest) (*pb.SquareRootResponse, error) {
+	number := req.GetNumber()
+	if number < 0.0 {
+		return nil, status.Error(
+			codes.InvalidArgument,
+			fmt.Sprintf("Received a negative argument: %v", number),
+		)
+	}
+	return &pb.SquareRootResponse{
+		SquareRoot: math.Sqrt(number),
+	}, nil
+}
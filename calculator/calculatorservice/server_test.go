@@ -0,0 +1,78 @@
+package calculatorservice
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/andreasatle/Udemy/grpc-go-course/calculator/calculatorpb"
+	"github.com/andreasatle/Udemy/grpc-go-course/streamerr/streamerrtest"
+	"google.golang.org/grpc"
+)
+
+// startServer serves CalculatorService over bufconn, see streamerrtest.
+func startServer(t *testing.T) (pb.CalculatorServiceClient, *streamerrtest.Server) {
+	t.Helper()
+	s := streamerrtest.Start(t, func(gs *grpc.Server) {
+		pb.RegisterCalculatorServiceServer(gs, &Server{})
+	})
+	return pb.NewCalculatorServiceClient(s.Conn), s
+}
+
+// sum returns a unary call, to check that the server still answers.
+func sum(c pb.CalculatorServiceClient) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		_, err := c.Sum(ctx, &pb.SumRequest{FirstNumber: 3, SecondNumber: 4})
+		return err
+	}
+}
+
+func TestPrimeDisconnect(t *testing.T) {
+	c, s := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := c.Prime(ctx, &pb.PrimeRequest{Number: 210})
+	if err != nil {
+		t.Fatalf("Prime: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	cancel()
+	s.CheckCanceled(t, sum(c))
+}
+
+func TestAverageDisconnect(t *testing.T) {
+	c, s := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := c.Average(ctx)
+	if err != nil {
+		t.Fatalf("Average: %v", err)
+	}
+	if err := stream.Send(&pb.AverageRequest{Number: 3}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	cancel()
+	s.CheckCanceled(t, sum(c))
+}
+
+func TestMaxDisconnect(t *testing.T) {
+	c, s := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := c.Max(ctx)
+	if err != nil {
+		t.Fatalf("Max: %v", err)
+	}
+	if err := stream.Send(&pb.MaxRequest{Number: 3}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	cancel()
+	s.CheckCanceled(t, sum(c))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/blogservice"
+	"github.com/andreasatle/Udemy/grpc-go-course/blog/pb"
+	"github.com/andreasatle/Udemy/grpc-go-course/bootstrap"
+	"github.com/andreasatle/Udemy/grpc-go-course/calculator/calculatorpb"
+	"github.com/andreasatle/Udemy/grpc-go-course/calculator/calculatorservice"
+	"github.com/andreasatle/Udemy/grpc-go-course/greet/greetpb"
+	"github.com/andreasatle/Udemy/grpc-go-course/greet/greetservice"
+	"github.com/andreasatle/Udemy/grpc-go-course/interceptor"
+	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc"
+)
+
+var (
+	enableGreet      = flag.Bool("greet", true, "Serve GreetService")
+	enableCalculator = flag.Bool("calculator", true, "Serve CalculatorService")
+	enableBlog       = flag.Bool("blog", true, "Serve BlogService and BlogAdminService, needs MongoDB")
+)
+
+// Unlike the greet server, TLS is disabled by default, as the calculator
+// and blog clients connect without it
+var serverFlags = bootstrap.RegisterFlags("COMBINED", bootstrap.Config{
+	Address:    "0.0.0.0:50051",
+	Reflection: true,
+})
+
+func main() {
+	// If we crash the code, we get the file and line-number
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+	flag.Parse()
+
+	config, err := serverFlags.Config()
+	if err != nil {
+		log.Fatalf("Failed to read the configuration: %v\n", err)
+	}
+
+	var client *mongo.Client
+	var blogs *blogservice.Service
+	if *enableBlog {
+		if client, err = blogservice.Connect(context.TODO()); err != nil {
+			log.Fatal(err)
+		}
+		slog.Info("Connected to MongoDB")
+
+		if blogs, err = blogservice.New(context.TODO(), client); err != nil {
+			log.Fatalln(err)
+		}
+	}
+
+	if config.TLS.CertFile == "" {
+		slog.Warn("Serving without TLS, see -tls-cert and -tls-key")
+	}
+
+	lis, err := config.Listen()
+	if err != nil {
+		log.Fatalf("Failed to listen: %v\n", err)
+	}
+
+	// All services share the rate limits of a client, the timeouts
+	// only apply to the blog calls
+	limits := interceptor.DefaultRateLimitConfig
+	limits.PerMethod = blogservice.MethodLimits
+	limiter := interceptor.NewRateLimiter(limits)
+	s, err := config.NewServer(
+		grpc.ChainUnaryInterceptor(limiter.UnaryServerInterceptor(), blogservice.UnaryAdminAuthInterceptor, blogservice.UnaryTimeoutInterceptor),
+		grpc.ChainStreamInterceptor(limiter.StreamServerInterceptor(), blogservice.StreamAdminAuthInterceptor, blogservice.StreamTimeoutInterceptor),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create the server: %v\n", err)
+	}
+
+	if *enableGreet {
+		greetpb.RegisterGreetServiceServer(s.Server, &greetservice.Server{})
+		s.RegisterGateway(greetpb.RegisterGreetServiceHandler)
+	}
+	if *enableCalculator {
+		calculatorpb.RegisterCalculatorServiceServer(s.Server, &calculatorservice.Server{})
+		s.RegisterGateway(calculatorpb.RegisterCalculatorServiceHandler)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if blogs != nil {
+		blogs.Register(s.Server)
+		s.RegisterGateway(pb.RegisterBlogServiceHandler)
+		go blogs.RunBackups(ctx)
+	}
+	s.SetServing()
+	if blogs != nil {
+		go blogs.MonitorHealth(ctx, s.Health)
+		go blogs.RunViewFlushes(ctx)
+	}
+
+	services := []string{}
+	for name := range s.GetServiceInfo() {
+		services = append(services, name)
+	}
+	slog.Info("Starting combined server", "address", config.Address, "services", services)
+	if err := s.Run(lis); err != nil {
+		log.Fatalf("Failed to serve: %v\n", err)
+	}
+	cancel()
+	if blogs != nil {
+		blogs.FlushViews(context.Background())
+	}
+	if client != nil {
+		disconnect(client)
+	}
+	slog.Info("End of program")
+}
+
+// disconnect closes the MongoDB client, once the server is stopped
+func disconnect(client *mongo.Client) {
+	slog.Info("Disconnecting from MongoDB")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := client.Disconnect(ctx); err != nil {
+		slog.Error("Failed to disconnect from MongoDB", "error", err)
+	}
+}
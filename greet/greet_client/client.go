@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/andreasatle/Udemy/grpc-go-course/greet/greetpb"
+	"github.com/andreasatle/Udemy/grpc-go-course/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
@@ -17,6 +19,13 @@ import (
 func main() {
 	fmt.Println("Hello world, from client!")
 
+	// Trace the calls when TRACE_EXPORTER is set, see the telemetry package
+	stopTracing, err := telemetry.Setup(telemetry.ConfigFromEnv("greet-client"))
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v\n", err)
+	}
+	defer stopTracing(context.Background())
+
 	certFile := "ssl/ca.crt"
 	creds, sslErr := credentials.NewClientTLSFromFile(certFile, "")
 	if sslErr != nil {
@@ -24,9 +33,9 @@ func main() {
 		return
 	}
 	opts := grpc.WithTransportCredentials(creds)
-	cc, err := grpc.Dial("localhost:50051", opts)
+	cc, err := grpc.Dial("localhost:50051", opts, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
 	if err != nil {
-		log.Fatal("Client could not connect to server: %v", err)
+		log.Fatalf("Client could not connect to server: %v", err)
 	}
 	defer cc.Close()
 
@@ -1,135 +1,56 @@
 package main
 
 import (
-	"context"
-	"fmt"
-	"io"
+	"flag"
 	"log"
-	"net"
-	"strconv"
-	"time"
+	"log/slog"
 
+	"github.com/andreasatle/Udemy/grpc-go-course/bootstrap"
 	"github.com/andreasatle/Udemy/grpc-go-course/greet/greetpb"
+	"github.com/andreasatle/Udemy/grpc-go-course/greet/greetservice"
+	"github.com/andreasatle/Udemy/grpc-go-course/interceptor"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials"
-	"google.golang.org/grpc/status"
 )
 
-type server struct{}
+var serverFlags = bootstrap.RegisterFlags("GREET", bootstrap.Config{
+	Address:    "0.0.0.0:50051",
+	Reflection: true,
+	TLS: bootstrap.TLSConfig{
+		CertFile: "ssl/server.crt",
+		KeyFile:  "ssl/server.pem",
+	},
+})
 
-func (*server) Greet(ctx context.Context, req *greetpb.GreetRequest) (*greetpb.GreetResponse, error) {
-	fmt.Printf("Greet function invoked on server: %v", req)
-	firstName := req.GetGreeting().GetFirstName()
-	result := "Hello " + firstName
-	res := &greetpb.GreetResponse{
-		Result: result,
-	}
-	return res, nil
-}
-
-func (*server) GreetManyTimes(req *greetpb.GreetManyTimesRequest, stream greetpb.GreetService_GreetManyTimesServer) error {
-	fmt.Printf("GreetManyTimes function invoked on server: %v\n", req)
-	firstName := req.GetGreeting().GetFirstName()
-	for i := 0; i < 10; i++ {
-		result := "Hello " + firstName + " number " + strconv.Itoa(i)
-		res := &greetpb.GreetManyTimesResponse{
-			Result: result,
-		}
-		stream.Send(res)
-		time.Sleep(1000 * time.Millisecond)
-	}
-	return nil
-}
-
-func (*server) LongGreet(stream greetpb.GreetService_LongGreetServer) error {
-	fmt.Println("LongGreet function invoked on server")
-	result := ""
-
-	for {
-		req, err := stream.Recv()
-		if err == io.EOF {
-			return stream.SendAndClose(&greetpb.LongGreetResponse{
-				Result: result,
-			})
-		}
-		if err != nil {
-			log.Fatalf("Error while reading client stream: %v", err)
-		}
-		firstName := req.GetGreeting().GetFirstName()
-		result += "Hello " + firstName + "! "
-	}
-}
-
-func (*server) GreetEveryone(stream greetpb.GreetService_GreetEveryoneServer) error {
-	fmt.Println("GreetEveryone function invoked on server")
-
-	for {
-		req, recvErr := stream.Recv()
-		if recvErr == io.EOF {
-			return nil
-		}
-		if recvErr != nil {
-			log.Fatalf("Error while reading client string: %v", recvErr)
-			return recvErr
-		}
-
-		firstName := req.GetGreeting().GetFirstName()
-		result := "Hello " + firstName + "! "
-
-		sendErr := stream.Send(&greetpb.GreetEveryoneResponse{
-			Result: result,
-		})
-		if sendErr != nil {
-			log.Fatalf("Error while sending data to client: %v", sendErr)
-			return sendErr
-		}
-	}
-}
-
-func (*server) GreetWithDeadline(ctx context.Context, req *greetpb.GreetWithDeadlineRequest) (*greetpb.GreetWithDeadlineResponse, error) {
-	fmt.Printf("GreetWithDeadline function invoked on server: %v\n", req)
+func main() {
+	flag.Parse()
 
-	for i := 0; i < 3; i++ {
-		if ctx.Err() == context.Canceled {
-			fmt.Println("The client canceled the request!")
-			return nil, status.Error(codes.Canceled, "The client canceled the request!")
-		}
-		time.Sleep(1 * time.Second)
-	}
-	firstName := req.GetGreeting().GetFirstName()
-	result := "Hello " + firstName
-	res := &greetpb.GreetWithDeadlineResponse{
-		Result: result,
+	config, err := serverFlags.Config()
+	if err != nil {
+		log.Fatalf("Failed to read the configuration: %v\n", err)
 	}
-	return res, nil
-}
-
-func main() {
-	fmt.Println("Hello world, from server!")
 
-	// Listen to port (some default grpc)
-	lis, err := net.Listen("tcp", "0.0.0.0:50051")
+	lis, err := config.Listen()
 	if err != nil {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	certFile := "ssl/server.crt"
-	keyFile := "ssl/server.pem"
-	creds, sslErr := credentials.NewServerTLSFromFile(certFile, keyFile)
-	if sslErr != nil {
-		log.Fatalf("Failed loading certificates: %v\n", sslErr)
-		return
+	// Create a new server, with rate limits for every client
+	limiter := interceptor.NewRateLimiter(interceptor.DefaultRateLimitConfig)
+	s, err := config.NewServer(
+		grpc.ChainUnaryInterceptor(limiter.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(limiter.StreamServerInterceptor()),
+	)
+	if err != nil {
+		log.Fatalf("Failed to create the server: %v\n", err)
 	}
-	opts := grpc.Creds(creds)
-
-	// Create a new server
-	s := grpc.NewServer(opts)
 
 	// Register the server at greetpb
-	greetpb.RegisterGreetServiceServer(s, &server{})
+	greetpb.RegisterGreetServiceServer(s.Server, &greetservice.Server{})
+	s.RegisterGateway(greetpb.RegisterGreetServiceHandler)
+	s.SetServing()
 
-	if err := s.Serve(lis); err != nil {
+	slog.Info("Starting greet server", "address", config.Address)
+	if err := s.Run(lis); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
 
@@ -0,0 +1,82 @@
+package greetservice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andreasatle/Udemy/grpc-go-course/greet/greetpb"
+	"github.com/andreasatle/Udemy/grpc-go-course/streamerr/streamerrtest"
+	"google.golang.org/grpc"
+)
+
+// startServer serves GreetService over bufconn, see streamerrtest.
+func startServer(t *testing.T) (greetpb.GreetServiceClient, *streamerrtest.Server) {
+	t.Helper()
+	s := streamerrtest.Start(t, func(gs *grpc.Server) {
+		greetpb.RegisterGreetServiceServer(gs, &Server{})
+	})
+	return greetpb.NewGreetServiceClient(s.Conn), s
+}
+
+// greet returns a unary call, to check that the server still answers.
+func greet(c greetpb.GreetServiceClient) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		req := &greetpb.GreetRequest{Greeting: &greetpb.Greeting{FirstName: "Ada"}}
+		_, err := c.Greet(ctx, req)
+		return err
+	}
+}
+
+func TestGreetManyTimesDisconnect(t *testing.T) {
+	c, s := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req := &greetpb.GreetManyTimesRequest{Greeting: &greetpb.Greeting{FirstName: "Ada"}}
+	stream, err := c.GreetManyTimes(ctx, req)
+	if err != nil {
+		t.Fatalf("GreetManyTimes: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	cancel()
+	s.CheckCanceled(t, greet(c))
+}
+
+func TestLongGreetDisconnect(t *testing.T) {
+	c, s := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := c.LongGreet(ctx)
+	if err != nil {
+		t.Fatalf("LongGreet: %v", err)
+	}
+	req := &greetpb.LongGreetRequest{Greeting: &greetpb.Greeting{FirstName: "Ada"}}
+	if err := stream.Send(req); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	cancel()
+	s.CheckCanceled(t, greet(c))
+}
+
+func TestGreetEveryoneDisconnect(t *testing.T) {
+	c, s := startServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := c.GreetEveryone(ctx)
+	if err != nil {
+		t.Fatalf("GreetEveryone: %v", err)
+	}
+	req := &greetpb.GreetEveryoneRequest{Greeting: &greetpb.Greeting{FirstName: "Ada"}}
+	if err := stream.Send(req); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	cancel()
+	s.CheckCanceled(t, greet(c))
+}
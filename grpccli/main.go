@@ -0,0 +1,324 @@
+// Command grpccli lists, describes and calls the services of a server with
+// reflection, with requests and responses as JSON, so that any method can
+// be tried without writing a client:
+//
+//	grpccli list
+//	grpccli list calculator.CalculatorService
+//	grpccli describe calculator.SumRequest
+//	grpccli call calculator.CalculatorService/Sum '{"firstNumber": 3, "secondNumber": 4}'
+//	echo '{"number": 3} {"number": 5}' | grpccli call calculator.CalculatorService/Max
+//	grpccli -H tenant:acme call blog.BlogService/ListBlog
+//
+// The requests of client streaming methods are a sequence of JSON objects,
+// read from stdin unless given as argument. A missing request of the other
+// methods is empty.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoprint"
+	"github.com/jhump/protoreflect/grpcreflect"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var (
+	addr    = flag.String("addr", "localhost:50051", "Address of the server")
+	caFile  = flag.String("ca-file", "", "CA certificate of a TLS server, empty connects without TLS")
+	timeout = flag.Duration("timeout", 30*time.Second, "Deadline of the command, 0 for none")
+	headers metadataFlag
+)
+
+func init() {
+	flag.Var(&headers, "H", "Request metadata as key:value, may be repeated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), `Usage: grpccli [flags] command
+
+Commands:
+  list                      List the services
+  list <service>            List the methods of a service
+  describe <symbol>         Describe a service, method, message or enum
+  call <method> [request]   Call a method, e.g. blog.BlogService/ReadBlog
+
+Flags:
+`)
+		flag.PrintDefaults()
+	}
+}
+
+// metadataFlag collects the -H flags.
+type metadataFlag []string
+
+func (m *metadataFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *metadataFlag) Set(value string) error {
+	if !strings.Contains(value, ":") {
+		return fmt.Errorf("expected key:value, got %q", value)
+	}
+	*m = append(*m, value)
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	if *timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *timeout)
+		defer cancel()
+	}
+	for _, header := range headers {
+		kv := strings.SplitN(header, ":", 2)
+		ctx = metadata.AppendToOutgoingContext(ctx, strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]))
+	}
+
+	cc, err := dial()
+	if err != nil {
+		fail("Cannot connect to %s: %v", *addr, err)
+	}
+	defer cc.Close()
+	rc := grpcreflect.NewClientAuto(ctx, cc)
+	defer rc.Reset()
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		err = listServices(rc)
+	case args[0] == "list" && len(args) == 2:
+		err = listMethods(rc, args[1])
+	case args[0] == "describe" && len(args) == 2:
+		err = describe(rc, args[1])
+	case args[0] == "call" && (len(args) == 2 || len(args) == 3):
+		input := ""
+		if len(args) == 3 {
+			input = args[2]
+		}
+		err = call(ctx, cc, rc, args[1], input)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		if s, ok := status.FromError(err); ok {
+			fail("%s: %s", s.Code(), s.Message())
+		}
+		fail("%v", err)
+	}
+}
+
+func dial() (*grpc.ClientConn, error) {
+	opts := grpc.WithInsecure()
+	if *caFile != "" {
+		creds, err := credentials.NewClientTLSFromFile(*caFile, "")
+		if err != nil {
+			return nil, fmt.Errorf("failed loading CA certificate: %v", err)
+		}
+		opts = grpc.WithTransportCredentials(creds)
+	}
+	return grpc.Dial(*addr, opts)
+}
+
+func listServices(rc *grpcreflect.Client) error {
+	services, err := rc.ListServices()
+	if err != nil {
+		return err
+	}
+	sort.Strings(services)
+	for _, service := range services {
+		fmt.Println(service)
+	}
+	return nil
+}
+
+func listMethods(rc *grpcreflect.Client, service string) error {
+	sd, err := rc.ResolveService(service)
+	if err != nil {
+		return err
+	}
+	for _, md := range sd.GetMethods() {
+		fmt.Printf("%s/%s\n", sd.GetFullyQualifiedName(), md.GetName())
+	}
+	return nil
+}
+
+func describe(rc *grpcreflect.Client, symbol string) error {
+	// Methods may be given like in the call command
+	symbol = strings.Replace(symbol, "/", ".", 1)
+	fd, err := rc.FileContainingSymbol(symbol)
+	if err != nil {
+		return err
+	}
+	d := fd.FindSymbol(symbol)
+	if d == nil {
+		return fmt.Errorf("symbol %s not found", symbol)
+	}
+	printer := &protoprint.Printer{Indent: "    "}
+	text, err := printer.PrintProtoToString(d)
+	if err != nil {
+		return err
+	}
+	fmt.Print(text)
+	return nil
+}
+
+// call sends the requests of input, and prints the responses as they are
+// received. The requests are sent concurrently with receiving the responses,
+// so that bidirectional streams see the responses in between.
+func call(ctx context.Context, cc *grpc.ClientConn, rc *grpcreflect.Client, method string, input string) error {
+	md, err := resolveMethod(rc, method)
+	if err != nil {
+		return err
+	}
+	requests, err := requestDecoder(md, input)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	streamDesc := &grpc.StreamDesc{
+		StreamName:    md.GetName(),
+		ServerStreams: md.IsServerStreaming(),
+		ClientStreams: md.IsClientStreaming(),
+	}
+	fullMethod := fmt.Sprintf("/%s/%s", md.GetService().GetFullyQualifiedName(), md.GetName())
+	stream, err := cc.NewStream(ctx, streamDesc, fullMethod)
+	if err != nil {
+		return err
+	}
+
+	sendErr := make(chan error, 1)
+	go func() {
+		err := sendRequests(stream, requests, md.UnwrapMethod().Input())
+		if err != nil {
+			cancel()
+		}
+		sendErr <- err
+	}()
+
+	output := md.UnwrapMethod().Output()
+	marshal := protojson.MarshalOptions{Multiline: true, Indent: "  "}
+	for {
+		res := dynamicpb.NewMessage(output)
+		err := stream.RecvMsg(res)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// A bad request is the cause of a call canceled by the sender
+			if errors.Is(ctx.Err(), context.Canceled) {
+				return <-sendErr
+			}
+			return err
+		}
+		data, err := marshal.Marshal(res)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	}
+
+	// The server may end the call before all requests are read
+	select {
+	case err := <-sendErr:
+		return err
+	default:
+		return nil
+	}
+}
+
+// sendRequests sends the requests and closes the sending side. A bad
+// request is returned without closing, so that the call can be canceled.
+func sendRequests(stream grpc.ClientStream, requests *json.Decoder, input protoreflect.MessageDescriptor) error {
+	for {
+		var raw json.RawMessage
+		err := requests.Decode(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid request: %v", err)
+		}
+		req := dynamicpb.NewMessage(input)
+		if err := protojson.Unmarshal(raw, req); err != nil {
+			return fmt.Errorf("invalid request %s: %v", raw, err)
+		}
+		if err := stream.SendMsg(req); err != nil {
+			// The error of the call is returned by RecvMsg
+			return nil
+		}
+	}
+	return stream.CloseSend()
+}
+
+// resolveMethod finds a method given as package.Service/Method or
+// package.Service.Method.
+func resolveMethod(rc *grpcreflect.Client, method string) (*desc.MethodDescriptor, error) {
+	i := strings.LastIndexAny(method, "/.")
+	if i < 0 {
+		return nil, fmt.Errorf("method %s should be given as package.Service/Method", method)
+	}
+	sd, err := rc.ResolveService(strings.TrimPrefix(method[:i], "/"))
+	if err != nil {
+		return nil, err
+	}
+	md := sd.FindMethodByName(method[i+1:])
+	if md == nil {
+		return nil, fmt.Errorf("service %s has no method %s", sd.GetFullyQualifiedName(), method[i+1:])
+	}
+	return md, nil
+}
+
+// requestDecoder reads the requests from input, or from stdin for client
+// streaming methods without input. Other methods get one request, empty
+// without input.
+func requestDecoder(md *desc.MethodDescriptor, input string) (*json.Decoder, error) {
+	switch {
+	case input != "":
+	case md.IsClientStreaming():
+		return json.NewDecoder(os.Stdin), nil
+	default:
+		input = "{}"
+	}
+	requests := json.NewDecoder(strings.NewReader(input))
+	if md.IsClientStreaming() {
+		return requests, nil
+	}
+
+	var first json.RawMessage
+	if err := requests.Decode(&first); err != nil {
+		return nil, fmt.Errorf("invalid request: %v", err)
+	}
+	if requests.More() {
+		return nil, fmt.Errorf("%s takes a single request", md.GetName())
+	}
+	return json.NewDecoder(strings.NewReader(string(first))), nil
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
@@ -0,0 +1,59 @@
+// Command healthcheck queries the gRPC health service of a server and exits
+// with status 0 if the service is serving, so that it can be used as a
+// container probe:
+//
+//	healthcheck -addr localhost:50051 -service blog.BlogService
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+var (
+	addr    = flag.String("addr", "localhost:50051", "Address of the server")
+	service = flag.String("service", "", "Service to check, empty checks the server as a whole")
+	timeout = flag.Duration("timeout", 5*time.Second, "Deadline of the check")
+	caFile  = flag.String("ca-file", "", "CA certificate of a TLS server, empty connects without TLS")
+)
+
+func main() {
+	flag.Parse()
+
+	opts := grpc.WithInsecure()
+	if *caFile != "" {
+		creds, err := credentials.NewClientTLSFromFile(*caFile, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed loading CA certificate: %v\n", err)
+			os.Exit(2)
+		}
+		opts = grpc.WithTransportCredentials(creds)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	cc, err := grpc.DialContext(ctx, *addr, opts, grpc.WithBlock())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot connect to %s: %v\n", *addr, err)
+		os.Exit(1)
+	}
+	defer cc.Close()
+
+	res, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{Service: *service})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Health check failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(res.GetStatus())
+	if res.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		os.Exit(1)
+	}
+}
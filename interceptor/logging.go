@@ -0,0 +1,178 @@
+package interceptor
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// redacted replaces the values of redacted string fields.
+const redacted = "[REDACTED]"
+
+// CallLogger logs every call with its method, peer, duration and status code.
+// At debug level the requests of unary calls are logged too, with the values
+// of the redacted fields left out.
+type CallLogger struct {
+	logger *slog.Logger
+	redact map[string]bool
+}
+
+// NewCallLogger creates a CallLogger. The redacted fields are given by their
+// proto names, e.g. "content", and are redacted in nested messages too.
+func NewCallLogger(logger *slog.Logger, redact []string) *CallLogger {
+	l := &CallLogger{logger: logger, redact: make(map[string]bool)}
+	for _, name := range redact {
+		l.redact[name] = true
+	}
+	return l
+}
+
+// UnaryServerInterceptor logs unary calls.
+func (l *CallLogger) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		res, err := handler(ctx, req)
+
+		attrs := callAttrs(ctx, info.FullMethod, start, err)
+		if l.logger.Enabled(ctx, slog.LevelDebug) {
+			attrs = append(attrs, slog.Any("request", l.payload(req)))
+		}
+		l.logger.LogAttrs(ctx, levelFor(err), "unary call", attrs...)
+		return res, err
+	}
+}
+
+// StreamServerInterceptor logs streams, with the number of messages
+// received and sent.
+func (l *CallLogger) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		stream := &countingStream{ServerStream: ss}
+		err := handler(srv, stream)
+
+		attrs := append(callAttrs(ss.Context(), info.FullMethod, start, err),
+			slog.Int64("received", stream.received.Load()),
+			slog.Int64("sent", stream.sent.Load()))
+		l.logger.LogAttrs(ss.Context(), levelFor(err), "stream", attrs...)
+		return err
+	}
+}
+
+func callAttrs(ctx context.Context, method string, start time.Time, err error) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.Duration("duration", time.Since(start)),
+		slog.String("code", status.Code(err).String()),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		attrs = append(attrs, slog.String("peer", p.Addr.String()))
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", status.Convert(err).Message()))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+	}
+	return attrs
+}
+
+// levelFor logs failures caused by the server as errors, and failures
+// caused by the client, like invalid arguments or exceeded quotas, as warnings.
+func levelFor(err error) slog.Level {
+	switch status.Code(err) {
+	case codes.OK:
+		return slog.LevelInfo
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.Unimplemented:
+		return slog.LevelError
+	default:
+		return slog.LevelWarn
+	}
+}
+
+// payload encodes a request as JSON, without the values of the redacted fields.
+func (l *CallLogger) payload(req interface{}) json.RawMessage {
+	m, ok := req.(protoadapt.MessageV1)
+	if !ok {
+		return nil
+	}
+	msg := proto.Clone(protoadapt.MessageV2Of(m))
+	redactFields(msg.ProtoReflect(), l.redact)
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// redactFields replaces the values of the redacted fields of m and its
+// nested messages. Strings are replaced by a marker, other values cleared.
+func redactFields(m protoreflect.Message, redact map[string]bool) {
+	var fields []protoreflect.FieldDescriptor
+	m.Range(func(fd protoreflect.FieldDescriptor, _ protoreflect.Value) bool {
+		fields = append(fields, fd)
+		return true
+	})
+
+	for _, fd := range fields {
+		v := m.Get(fd)
+		switch {
+		case redact[string(fd.Name())]:
+			if fd.Kind() == protoreflect.StringKind && fd.Cardinality() != protoreflect.Repeated {
+				m.Set(fd, protoreflect.ValueOfString(redacted))
+			} else {
+				m.Clear(fd)
+			}
+		case fd.IsMap():
+			if fd.MapValue().Message() != nil {
+				v.Map().Range(func(_ protoreflect.MapKey, value protoreflect.Value) bool {
+					redactFields(value.Message(), redact)
+					return true
+				})
+			}
+		case fd.IsList():
+			if fd.Message() != nil {
+				list := v.List()
+				for i := 0; i < list.Len(); i++ {
+					redactFields(list.Get(i).Message(), redact)
+				}
+			}
+		case fd.Message() != nil:
+			redactFields(v.Message(), redact)
+		}
+	}
+}
+
+// countingStream counts the messages of a server stream.
+type countingStream struct {
+	grpc.ServerStream
+	received atomic.Int64
+	sent     atomic.Int64
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Add(1)
+	}
+	return err
+}
+
+func (s *countingStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Add(1)
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics records the calls of a server as Prometheus metrics, labeled by
+// service and method, in the style of the usual grpc_server_* metrics.
+type Metrics struct {
+	started  *prometheus.CounterVec
+	handled  *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+	received *prometheus.CounterVec
+	sent     *prometheus.CounterVec
+}
+
+// NewMetrics creates the metrics and registers them with reg.
+func NewMetrics(reg prometheus.Registerer) *Metrics {
+	factory := promauto.With(reg)
+	labels := []string{"grpc_type", "grpc_service", "grpc_method"}
+	return &Metrics{
+		started: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_started_total",
+			Help: "Number of calls started on the server.",
+		}, labels),
+		handled: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_handled_total",
+			Help: "Number of calls completed on the server, by status code.",
+		}, append(labels, "grpc_code")),
+		latency: factory.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "grpc_server_handling_seconds",
+			Help:    "Time from the start of a call until the handler returned.",
+			Buckets: prometheus.DefBuckets,
+		}, labels),
+		received: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_msg_received_total",
+			Help: "Number of messages received from clients.",
+		}, labels),
+		sent: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_msg_sent_total",
+			Help: "Number of messages sent to clients.",
+		}, labels),
+	}
+}
+
+// UnaryServerInterceptor records unary calls.
+func (m *Metrics) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		labels := methodLabels("unary", info.FullMethod)
+		start := time.Now()
+		m.started.With(labels).Inc()
+		m.received.With(labels).Inc()
+
+		res, err := handler(ctx, req)
+		if err == nil {
+			m.sent.With(labels).Inc()
+		}
+		m.done(labels, start, err)
+		return res, err
+	}
+}
+
+// StreamServerInterceptor records streams and their messages.
+func (m *Metrics) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		streamType := "bidi_stream"
+		switch {
+		case info.IsClientStream && !info.IsServerStream:
+			streamType = "client_stream"
+		case !info.IsClientStream && info.IsServerStream:
+			streamType = "server_stream"
+		}
+		labels := methodLabels(streamType, info.FullMethod)
+		start := time.Now()
+		m.started.With(labels).Inc()
+
+		err := handler(srv, &metricsStream{
+			ServerStream: ss,
+			received:     m.received.With(labels),
+			sent:         m.sent.With(labels),
+		})
+		m.done(labels, start, err)
+		return err
+	}
+}
+
+func (m *Metrics) done(labels prometheus.Labels, start time.Time, err error) {
+	m.latency.With(labels).Observe(time.Since(start).Seconds())
+	handled := prometheus.Labels{"grpc_code": status.Code(err).String()}
+	for k, v := range labels {
+		handled[k] = v
+	}
+	m.handled.With(handled).Inc()
+}
+
+// methodLabels splits a full method name, e.g. "/blog.BlogService/ListBlog".
+func methodLabels(callType string, fullMethod string) prometheus.Labels {
+	service, method := "unknown", "unknown"
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		service, method = strings.TrimPrefix(fullMethod[:i], "/"), fullMethod[i+1:]
+	}
+	return prometheus.Labels{"grpc_type": callType, "grpc_service": service, "grpc_method": method}
+}
+
+// metricsStream counts the messages of a server stream.
+type metricsStream struct {
+	grpc.ServerStream
+	received prometheus.Counter
+	sent     prometheus.Counter
+}
+
+func (s *metricsStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received.Inc()
+	}
+	return err
+}
+
+func (s *metricsStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent.Inc()
+	}
+	return err
+}
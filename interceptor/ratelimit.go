@@ -0,0 +1,299 @@
+// Package interceptor contains gRPC server interceptors shared by the
+// greet, calculator and blog servers.
+package interceptor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RetryAfterKey is the trailer telling a rate limited client how many
+// seconds to wait before retrying.
+const RetryAfterKey = "retry-after"
+
+// Metadata of the calls of the JSON gateway, see GatewayMetadata.
+const (
+	gatewayClientKey = "x-gateway-client"
+	gatewayTokenKey  = "x-gateway-token"
+)
+
+// gatewayToken proves that a call comes from the gateway of this process.
+// It never leaves the process, so clients cannot forge gateway calls.
+var gatewayToken = newGatewayToken()
+
+func newGatewayToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// GatewayMetadata is the metadata the JSON gateway sends with the call of
+// the HTTP client at remoteAddr, so that the client is rate limited by its
+// own address instead of the one of the gateway.
+func GatewayMetadata(remoteAddr string) metadata.MD {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	return metadata.Pairs(gatewayClientKey, host, gatewayTokenKey, gatewayToken)
+}
+
+// IsGatewayMetadata reports whether key is metadata of the gateway, which
+// the gateway must not forward from the headers of HTTP clients.
+func IsGatewayMetadata(key string) bool {
+	return strings.EqualFold(key, gatewayClientKey) || strings.EqualFold(key, gatewayTokenKey)
+}
+
+// idleTimeout is how long the limiters of a client are kept after its last call.
+const idleTimeout = 10 * time.Minute
+
+// Limit is a token bucket refilled with Rate tokens per second, holding
+// at most Burst tokens. A zero Rate means no limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitConfig configures a RateLimiter.
+type RateLimitConfig struct {
+	// PerClient limits all calls of a client
+	PerClient Limit
+	// PerMethod additionally limits the calls of a client to a method,
+	// keyed by full method name, e.g. "/blog.BlogService/ListBlog"
+	PerMethod map[string]Limit
+	// MaxStreams is the number of concurrent streams of a client,
+	// 0 means no limit
+	MaxStreams int
+	// MaxStreamDuration is how long a stream may be held open,
+	// 0 means no limit
+	MaxStreamDuration time.Duration
+}
+
+// DefaultRateLimitConfig is a reasonable configuration for the course servers.
+var DefaultRateLimitConfig = RateLimitConfig{
+	PerClient:         Limit{Rate: 20, Burst: 40},
+	MaxStreams:        10,
+	MaxStreamDuration: 10 * time.Minute,
+}
+
+// RateLimiter limits the calls of each client with token buckets, and caps
+// the number and duration of their streams. Clients are identified by the
+// common name of a verified TLS client certificate, or else by IP address.
+// Calls of the JSON gateway are identified by the address of the HTTP
+// client, and gRPC-Web calls, which are served in-process, have the HTTP
+// client as peer.
+type RateLimiter struct {
+	config RateLimitConfig
+
+	mu        sync.Mutex
+	clients   map[string]*clientLimits
+	lastSweep time.Time
+}
+
+type clientLimits struct {
+	all      *rate.Limiter
+	methods  map[string]*rate.Limiter
+	streams  int
+	lastSeen time.Time
+}
+
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		config:    config,
+		clients:   make(map[string]*clientLimits),
+		lastSweep: time.Now(),
+	}
+}
+
+// UnaryServerInterceptor rate limits unary calls.
+func (l *RateLimiter) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if delay, ok := l.allow(clientKey(ctx), info.FullMethod); !ok {
+			grpc.SetTrailer(ctx, retryAfter(delay))
+			return nil, status.Errorf(codes.ResourceExhausted, "Rate limit exceeded for %s, retry in %v", info.FullMethod, delay)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor rate limits the start of streams, and caps the
+// number of concurrent streams and their duration.
+func (l *RateLimiter) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		key := clientKey(ss.Context())
+		if delay, ok := l.allow(key, info.FullMethod); !ok {
+			ss.SetTrailer(retryAfter(delay))
+			return status.Errorf(codes.ResourceExhausted, "Rate limit exceeded for %s, retry in %v", info.FullMethod, delay)
+		}
+		if !l.openStream(key) {
+			ss.SetTrailer(retryAfter(time.Second))
+			return status.Errorf(codes.ResourceExhausted, "Too many concurrent streams, at most %d are allowed", l.config.MaxStreams)
+		}
+		defer l.closeStream(key)
+
+		if l.config.MaxStreamDuration <= 0 {
+			return handler(srv, ss)
+		}
+		ctx, cancel := context.WithTimeout(ss.Context(), l.config.MaxStreamDuration)
+		defer cancel()
+		return handler(srv, &wrappedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// allow takes a token from the buckets of the client and method. If the
+// call is not allowed, it returns how long to wait for the tokens.
+func (l *RateLimiter) allow(key string, method string) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	client := l.client(key, now)
+
+	limiters := []*rate.Limiter{}
+	if client.all != nil {
+		limiters = append(limiters, client.all)
+	}
+	if limit, ok := l.config.PerMethod[method]; ok && limit.Rate > 0 {
+		limiter, ok := client.methods[method]
+		if !ok {
+			limiter = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+			client.methods[method] = limiter
+		}
+		limiters = append(limiters, limiter)
+	}
+
+	// Reserve from all buckets, and give the tokens back if any is empty
+	reservations := make([]*rate.Reservation, 0, len(limiters))
+	var delay time.Duration
+	for _, limiter := range limiters {
+		r := limiter.ReserveN(now, 1)
+		reservations = append(reservations, r)
+		if !r.OK() {
+			// The call can never be allowed, e.g. with a zero burst
+			delay = time.Duration(math.MaxInt64)
+		} else if d := r.DelayFrom(now); d > delay {
+			delay = d
+		}
+	}
+	if delay > 0 {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+		return delay, false
+	}
+	return 0, true
+}
+
+func (l *RateLimiter) openStream(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client := l.client(key, time.Now())
+	if l.config.MaxStreams > 0 && client.streams >= l.config.MaxStreams {
+		return false
+	}
+	client.streams++
+	return true
+}
+
+func (l *RateLimiter) closeStream(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client := l.client(key, time.Now())
+	client.streams--
+}
+
+// client returns the limits of a client, creating them on first use.
+// Must be called with l.mu held.
+func (l *RateLimiter) client(key string, now time.Time) *clientLimits {
+	if now.Sub(l.lastSweep) > idleTimeout {
+		for k, c := range l.clients {
+			if c.streams == 0 && now.Sub(c.lastSeen) > idleTimeout {
+				delete(l.clients, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	client, ok := l.clients[key]
+	if !ok {
+		client = &clientLimits{methods: make(map[string]*rate.Limiter)}
+		if l.config.PerClient.Rate > 0 {
+			client.all = rate.NewLimiter(rate.Limit(l.config.PerClient.Rate), l.config.PerClient.Burst)
+		}
+		l.clients[key] = client
+	}
+	client.lastSeen = now
+	return client
+}
+
+// clientKey identifies the client of a call.
+func clientKey(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "unknown"
+	}
+	if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+		chains := tlsInfo.State.VerifiedChains
+		if len(chains) > 0 && len(chains[0]) > 0 {
+			return "cn:" + chains[0][0].Subject.CommonName
+		}
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	if client, ok := gatewayClient(ctx); ok {
+		return client
+	}
+	return host
+}
+
+// gatewayClient returns the address of the HTTP client of a call made by
+// the JSON gateway of this process. Other calls, and headers like
+// x-forwarded-for, are not trusted, as any client can set them.
+func gatewayClient(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens, clients := md.Get(gatewayTokenKey), md.Get(gatewayClientKey)
+	if len(tokens) != 1 || len(clients) != 1 || clients[0] == "" {
+		return "", false
+	}
+	if subtle.ConstantTimeCompare([]byte(tokens[0]), []byte(gatewayToken)) != 1 {
+		return "", false
+	}
+	return clients[0], true
+}
+
+func retryAfter(delay time.Duration) metadata.MD {
+	seconds := int64(math.Ceil(delay.Seconds()))
+	return metadata.Pairs(RetryAfterKey, strconv.FormatInt(seconds, 10))
+}
+
+// wrappedStream replaces the context of a server stream.
+type wrappedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *wrappedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,149 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestClientKeyTrustsOnlyTheGateway(t *testing.T) {
+	loopback := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 4711}
+	remote := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 4711}
+	gateway := GatewayMetadata("198.51.100.7:50000")
+
+	tests := []struct {
+		name string
+		addr net.Addr
+		md   metadata.MD
+		want string
+	}{
+		{"gateway", loopback, gateway, "198.51.100.7"},
+		{"forged token", loopback, metadata.Pairs(gatewayClientKey, "203.0.113.1", gatewayTokenKey, "guess"), "127.0.0.1"},
+		{"forged client", loopback, metadata.Join(metadata.Pairs(gatewayClientKey, "203.0.113.1"), gateway), "127.0.0.1"},
+		{"forwarded for", loopback, metadata.Pairs("x-forwarded-for", "203.0.113.1"), "127.0.0.1"},
+		{"direct call", remote, metadata.Pairs("x-forwarded-for", "203.0.113.1"), "192.0.2.1"},
+		{"local call", loopback, nil, "127.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: tt.addr})
+			ctx = metadata.NewIncomingContext(ctx, tt.md)
+			if got := clientKey(ctx); got != tt.want {
+				t.Errorf("clientKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsGatewayMetadata(t *testing.T) {
+	for _, key := range []string{"X-Gateway-Client", "x-gateway-token"} {
+		if !IsGatewayMetadata(key) {
+			t.Errorf("IsGatewayMetadata(%q) = false", key)
+		}
+	}
+	if IsGatewayMetadata("tenant") {
+		t.Errorf("IsGatewayMetadata(%q) = true", "tenant")
+	}
+}
+
+// startLimitedServer serves the health service over bufconn, behind a
+// rate limiter with config.
+func startLimitedServer(t *testing.T, config RateLimitConfig) healthpb.HealthClient {
+	t.Helper()
+	limiter := NewRateLimiter(config)
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(
+		grpc.UnaryInterceptor(limiter.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(limiter.StreamServerInterceptor()))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Cannot dial server: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return healthpb.NewHealthClient(cc)
+}
+
+func checkRetryAfter(t *testing.T, trailer metadata.MD) {
+	t.Helper()
+	values := trailer.Get(RetryAfterKey)
+	if len(values) != 1 || values[0] == "" || values[0] == "0" {
+		t.Errorf("%s trailer = %q, want a positive number of seconds", RetryAfterKey, values)
+	}
+}
+
+func TestRateLimitRefusesCallsOverBurst(t *testing.T) {
+	c := startLimitedServer(t, RateLimitConfig{PerClient: Limit{Rate: 0.01, Burst: 2}})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Fatalf("Check %d: %v", i, err)
+		}
+	}
+	var trailer metadata.MD
+	_, err := c.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("Check over burst = %v, want %v", err, codes.ResourceExhausted)
+	}
+	checkRetryAfter(t, trailer)
+}
+
+func TestRateLimitCapsStreams(t *testing.T) {
+	c := startLimitedServer(t, RateLimitConfig{MaxStreams: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	first, cancelFirst := context.WithCancel(ctx)
+	watch, err := c.Watch(first, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if _, err := watch.Recv(); err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+
+	second, err := c.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	if _, err := second.Recv(); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second stream = %v, want %v", err, codes.ResourceExhausted)
+	}
+	checkRetryAfter(t, second.Trailer())
+
+	// Closing the first stream makes room for another one
+	cancelFirst()
+	for {
+		third, err := c.Watch(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("Watch: %v", err)
+		}
+		_, err = third.Recv()
+		if err == nil {
+			return
+		}
+		if status.Code(err) != codes.ResourceExhausted || ctx.Err() != nil {
+			t.Fatalf("stream after closing the first = %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,94 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// CorrelationIDKey is the trailer with the ID of a recovered panic, which
+// is also logged with the stack trace.
+const CorrelationIDKey = "correlation-id"
+
+// Recovery turns panics of handlers into Internal errors, so that a bug in
+// one call does not crash the whole server.
+type Recovery struct {
+	panics *prometheus.CounterVec
+}
+
+// NewRecovery creates a Recovery, counting the panics in reg.
+func NewRecovery(reg prometheus.Registerer) *Recovery {
+	return &Recovery{
+		panics: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "grpc_server_panics_total",
+			Help: "Number of panics recovered in handlers.",
+		}, []string{"grpc_service", "grpc_method"}),
+	}
+}
+
+// UnaryServerInterceptor recovers panics of unary handlers.
+func (r *Recovery) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				id := r.recovered(ctx, info.FullMethod, p)
+				grpc.SetTrailer(ctx, metadata.Pairs(CorrelationIDKey, id))
+				res, err = nil, internalPanicError(id)
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor recovers panics of stream handlers.
+func (r *Recovery) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				id := r.recovered(ss.Context(), info.FullMethod, p)
+				ss.SetTrailer(metadata.Pairs(CorrelationIDKey, id))
+				err = internalPanicError(id)
+			}
+		}()
+		return handler(srv, ss)
+	}
+}
+
+// recovered logs a panic with its stack trace, and returns its correlation ID.
+func (r *Recovery) recovered(ctx context.Context, method string, p interface{}) string {
+	id := correlationID()
+	labels := methodLabels("", method)
+	r.panics.WithLabelValues(labels["grpc_service"], labels["grpc_method"]).Inc()
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("correlation_id", id),
+		slog.String("panic", fmt.Sprint(p)),
+		slog.String("stack", string(debug.Stack())),
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+	}
+	slog.LogAttrs(ctx, slog.LevelError, "Recovered panic in handler", attrs...)
+	return id
+}
+
+func internalPanicError(id string) error {
+	return status.Errorf(codes.Internal, "Internal server error, correlation ID %s", id)
+}
+
+func correlationID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
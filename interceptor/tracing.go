@@ -0,0 +1,93 @@
+package interceptor
+
+import (
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+var tracer = otel.Tracer("github.com/andreasatle/Udemy/grpc-go-course/interceptor")
+
+// TraceStreamBatches traces the messages of streams in batches. A span covers
+// up to size messages sent or received, as a child of the span of the call,
+// so that long streams show where the time went without a span per message.
+func TraceStreamBatches(size int) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		stream := &batchStream{ServerStream: ss, name: strings.TrimPrefix(info.FullMethod, "/") + "/batch", size: size}
+		err := handler(srv, stream)
+		stream.endBatch()
+		return err
+	}
+}
+
+// batchStream keeps a span open for the current batch of messages.
+type batchStream struct {
+	grpc.ServerStream
+	name string
+	size int
+
+	mu       sync.Mutex
+	span     trace.Span
+	batches  int
+	received int
+	sent     int
+}
+
+func (s *batchStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.record(true)
+	}
+	return err
+}
+
+func (s *batchStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.record(false)
+	}
+	return err
+}
+
+func (s *batchStream) record(received bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.span == nil {
+		s.batches++
+		_, s.span = tracer.Start(s.ServerStream.Context(), s.name,
+			trace.WithAttributes(attribute.Int("batch", s.batches)))
+	}
+	if received {
+		s.received++
+	} else {
+		s.sent++
+	}
+	if s.received+s.sent >= s.size {
+		s.endBatchLocked()
+	}
+}
+
+func (s *batchStream) endBatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.endBatchLocked()
+}
+
+func (s *batchStream) endBatchLocked() {
+	if s.span == nil {
+		return
+	}
+	s.span.SetAttributes(
+		attribute.Int("messages.received", s.received),
+		attribute.Int("messages.sent", s.sent),
+	)
+	s.span.End()
+	s.span = nil
+	s.received, s.sent = 0, 0
+}
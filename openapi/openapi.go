@@ -0,0 +1,54 @@
+// Package openapi holds the OpenAPI v3 document of the HTTP/JSON gateway.
+// openapi.yaml is generated from the protos by generate.sh, do not edit it.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var document []byte
+
+// JSON returns the document as JSON, with only the paths of the given
+// services, e.g. "blog.BlogService". Without services all paths are kept.
+func JSON(services ...string) ([]byte, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(document, &doc); err != nil {
+		return nil, err
+	}
+	if len(services) > 0 {
+		if paths, ok := doc["paths"].(map[string]interface{}); ok {
+			filterPaths(paths, services)
+		}
+	}
+	return json.Marshal(doc)
+}
+
+// filterPaths removes the paths of the services not given. The operations
+// are tagged with the name of their service, without the proto package.
+func filterPaths(paths map[string]interface{}, services []string) {
+	keep := make(map[string]bool)
+	for _, service := range services {
+		keep[service[strings.LastIndex(service, ".")+1:]] = true
+	}
+	for path, item := range paths {
+		operations, _ := item.(map[string]interface{})
+		served := false
+		for _, operation := range operations {
+			op, _ := operation.(map[string]interface{})
+			tags, _ := op["tags"].([]interface{})
+			for _, tag := range tags {
+				if name, ok := tag.(string); ok && keep[name] {
+					served = true
+				}
+			}
+		}
+		if !served {
+			delete(paths, path)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+// Package streamerr converts the errors of streaming RPCs to status errors.
+package streamerr
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Status converts a failed receive or send on a stream to a status error,
+// instead of taking the server down with it. A client that cancels or goes
+// away mid-stream only ends its own call.
+func Status(ctx context.Context, action string, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return status.Errorf(codes.Unavailable, "Connection lost while %s: %v", action, err)
+	}
+	if s, ok := status.FromError(err); ok && s.Code() != codes.Unknown {
+		return s.Err()
+	}
+	return status.Errorf(codes.Internal, "Error while %s: %v", action, err)
+}
@@ -0,0 +1,83 @@
+// Package streamerrtest serves stream handlers over bufconn to a client
+// that disconnects mid-stream, for the tests of their errors.
+package streamerrtest
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// blockingStream holds back all but the first message sent until the call
+// ends, so that the client disconnects mid-stream.
+type blockingStream struct {
+	grpc.ServerStream
+	sent int
+}
+
+func (s *blockingStream) SendMsg(m interface{}) error {
+	if s.sent++; s.sent > 1 {
+		<-s.Context().Done()
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// Server is a gRPC server on bufconn with a client connection to it.
+type Server struct {
+	Conn *grpc.ClientConn
+	errs chan error // Returned by the stream handlers
+}
+
+// Start serves the services registered by register over bufconn, until
+// the test ends.
+func Start(t testing.TB, register func(*grpc.Server)) *Server {
+	t.Helper()
+	errs := make(chan error, 1)
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.StreamInterceptor(
+		func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			err := handler(srv, &blockingStream{ServerStream: ss})
+			errs <- err
+			return err
+		}))
+	register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	cc, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("Cannot dial server: %v", err)
+	}
+	t.Cleanup(func() { cc.Close() })
+	return &Server{Conn: cc, errs: errs}
+}
+
+// CheckCanceled checks that the stream handler ended with a Canceled
+// status, and that the server still answers the unary call made by ping.
+func (s *Server) CheckCanceled(t testing.TB, ping func(ctx context.Context) error) {
+	t.Helper()
+	select {
+	case err := <-s.errs:
+		if _, ok := status.FromError(err); !ok || status.Code(err) != codes.Canceled {
+			t.Errorf("handler returned %v, want a %v status", err, codes.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not return after the client disconnected")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := ping(ctx); err != nil {
+		t.Errorf("Call after disconnect: %v", err)
+	}
+}
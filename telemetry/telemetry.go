@@ -0,0 +1,94 @@
+// Package telemetry sets up OpenTelemetry tracing for the servers and
+// clients of the course. The trace context is propagated in the gRPC
+// metadata with the W3C traceparent header.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Exporters of the traces.
+const (
+	ExporterNone   = "none"
+	ExporterStderr = "stderr" // JSON spans on stderr, apart from the logs on stdout
+	ExporterFile   = "file"   // JSON spans appended to a file
+)
+
+// Config selects where the traces are exported to.
+type Config struct {
+	ServiceName string `yaml:"service_name"`
+	Exporter    string `yaml:"exporter"` // none, stderr or file
+	File        string `yaml:"file"`     // Output of the file exporter
+}
+
+// ConfigFromEnv reads the exporter from TRACE_EXPORTER and TRACE_FILE,
+// for the clients that have no config file.
+func ConfigFromEnv(serviceName string) Config {
+	return Config{
+		ServiceName: serviceName,
+		Exporter:    os.Getenv("TRACE_EXPORTER"),
+		File:        os.Getenv("TRACE_FILE"),
+	}
+}
+
+// Setup installs the global tracer provider and propagator. The returned
+// function flushes the pending spans and must be called before exiting.
+// Without an exporter, the trace context is still propagated, but no
+// spans are recorded.
+func Setup(c Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var w io.Writer
+	var closer io.Closer
+	switch c.Exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterStderr:
+		w = os.Stderr
+	case ExporterFile:
+		if c.File == "" {
+			return nil, fmt.Errorf("the file exporter needs a trace file")
+		}
+		f, err := os.OpenFile(c.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		w, closer = f, f
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", c.Exporter)
+	}
+
+	exporter, err := stdouttrace.New(stdouttrace.WithWriter(w))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName(c.ServiceName),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}